@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/api"
+	"github.com/fbngrm/crypto-compare/pkg/feed"
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/output"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/fbngrm/crypto-compare/pkg/pipeline"
+	"github.com/fbngrm/crypto-compare/pkg/record"
+	"github.com/fbngrm/crypto-compare/pkg/replay"
+	"github.com/shopspring/decimal"
+)
+
+// bookFlags are the flags of the commands that build order books.
+type bookFlags struct {
+	format        string
+	symbols       string
+	defaultSymbol string
+	tick          string
+	lot           string
+}
+
+func (f *bookFlags) register(fs *flag.FlagSet, format string) {
+	fs.StringVar(&f.format, "format", format, "feed format, one of "+strings.Join(parse.Formats, ", "))
+	fs.StringVar(&f.symbols, "symbols", "", "comma separated symbols to keep, all if empty")
+	fs.StringVar(&f.defaultSymbol, "default-symbol", "", "symbol of updates that do not name it, e.g. of the json format or Binance snapshots "+
+		"(default BTC-USD, for binance the symbol of -symbols)")
+	fs.StringVar(&f.tick, "tick", "0.01", "tick size of the instruments")
+	fs.StringVar(&f.lot, "lot", "0.00000001", "lot size of the instruments")
+}
+
+// newManager creates a book manager, opts are applied after the options of the flags.
+func (f *bookFlags) newManager(opts ...feed.ManagerOption) (*feed.BookManager, error) {
+	tick, err := decimal.NewFromString(f.tick)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tick size: %w", err)
+	}
+	lot, err := decimal.NewFromString(f.lot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lot size: %w", err)
+	}
+
+	defaultSymbol, err := f.symbol()
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]feed.ManagerOption{
+		feed.WithDefaultSymbol(defaultSymbol),
+		feed.WithErrorHandler(func(symbol string, err error) {
+			// stale updates are skipped, on gaps the synchronizer waits for a fresh snapshot
+			log.Printf("%s: %v\n", symbol, err)
+		}),
+	}, opts...)
+	if symbols := list(f.symbols); len(symbols) > 0 {
+		opts = append(opts, feed.WithSymbols(symbols...))
+	}
+	return feed.NewBookManager(func(symbol string) *orderbook.OrderBook {
+		return orderbook.NewOrderBook(orderbook.WithInstrument(orderbook.NewInstrument(symbol, tick, lot)))
+	}, opts...), nil
+}
+
+// symbol returns the symbol of updates that do not name it. Binance snapshots do not name their symbol, they belong
+// to the symbol of the diffs, so it is taken from -symbols if the flag is not set.
+func (f *bookFlags) symbol() (string, error) {
+	switch {
+	case f.defaultSymbol != "":
+		return f.defaultSymbol, nil
+	case f.format != "binance":
+		return "BTC-USD", nil
+	}
+	if symbols := list(f.symbols); len(symbols) == 1 {
+		return symbols[0], nil
+	}
+	return "", errors.New("binance snapshots do not name their symbol, set -default-symbol or a single symbol with -symbols")
+}
+
+// outputFlags are the flags of the commands that print the books.
+type outputFlags struct {
+	output      string
+	depth       int
+	changesOnly bool
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.output, "output", "tuple", "output format, one of tuple, json, csv")
+	fs.IntVar(&f.depth, "depth", 0, "number of levels per side printed by the json and csv formats")
+	fs.BoolVar(&f.changesOnly, "changes-only", true, "print only if the best bid or ask changed")
+}
+
+// managerOptions returns the options that print the book of a symbol after every message.
+func (f *outputFlags) managerOptions() ([]feed.ManagerOption, error) {
+	format, err := output.ParseFormat(f.output)
+	if err != nil {
+		return nil, err
+	}
+	var opts []output.Option
+	if f.depth > 0 {
+		opts = append(opts, output.WithDepth(f.depth))
+	}
+	if f.changesOnly {
+		opts = append(opts, output.WithChangesOnly())
+	}
+	w := output.NewWriter(os.Stdout, format, opts...)
+
+	managerOpts := []feed.ManagerOption{
+		feed.WithUpdateHandler(func(symbol string, u parse.Update, ob *orderbook.ConcurrentOrderBook) {
+			if err := w.Write(symbol, u.Offset, ob); err != nil {
+				log.Println(err)
+			}
+		}),
+	}
+	if f.depth > 0 {
+		managerOpts = append(managerOpts, feed.WithDepth(f.depth))
+	}
+	return managerOpts, nil
+}
+
+// open returns the concatenated files, stdin if there are none or a file is -. Compressed files are decompressed.
+func open(names []string) (io.ReadCloser, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	files := make([]io.ReadCloser, 0, len(names))
+	for _, name := range names {
+		if name == "-" {
+			files = append(files, os.Stdin)
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			closeAll(files)
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 1 {
+		// a single file can be resumed by seeking, the parser decompresses it
+		return files[0], nil
+	}
+	// every file is decompressed on its own, they do not need to share the compression
+	readers := make([]io.Reader, len(files))
+	closers := files
+	for i, f := range files {
+		d, err := parse.Decompress(f)
+		if err != nil {
+			closeAll(closers)
+			return nil, fmt.Errorf("error reading %s: %w", names[i], err)
+		}
+		readers[i] = d
+		closers = append(closers, d)
+	}
+	return multiReadCloser{Reader: io.MultiReader(readers...), files: closers}, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	files []io.ReadCloser
+}
+
+func (m multiReadCloser) Close() error {
+	return closeAll(m.files)
+}
+
+func closeAll(files []io.ReadCloser) error {
+	var err error
+	for _, f := range files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// newParser opens the files and returns a parser of the feed format.
+func newParser(format string, names []string, opts ...parse.Option) (parse.FeedParser, error) {
+	rc, err := open(names)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parse.NewFeedParser(format, rc, opts...)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// run runs the pipeline and logs how it stopped.
+func run(ctx context.Context, p parse.FeedParser, a pipeline.Applier, opts ...pipeline.Option) pipeline.Result {
+	opts = append([]pipeline.Option{
+		pipeline.WithErrorHandler(func(u parse.Update, err error) {
+			log.Println(err)
+		}),
+	}, opts...)
+	res := pipeline.NewRunner(p, a, opts...).Run(ctx) // we block until the stream ends or the context is canceled and all updates are applied
+	if res.Err != nil {
+		log.Println(res.Err)
+	}
+	log.Printf("applied %d updates, rejected %d, last offset %d\n", res.Applied, res.Rejected, res.Last.Offset)
+	return res
+}
+
+func replayCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var books bookFlags
+	books.register(fs, "json")
+	var out outputFlags
+	out.register(fs)
+	checkpoint := fs.String("checkpoint", "", "checkpoint file, the input is resumed from it if it exists")
+	speed := fs.Float64("speed", 0, "replay speed relative to the timestamps of the messages, 0 is as fast as possible")
+	from := fs.String("start", "", "RFC 3339 time to start the timed replay at, earlier messages are applied immediately")
+	fs.Parse(args)
+
+	opts, err := out.managerOptions()
+	if err != nil {
+		return err
+	}
+	// a capture is replayed without dropping updates
+	manager, err := books.newManager(append(opts, feed.WithBackpressure())...)
+	if err != nil {
+		return err
+	}
+
+	var parserOpts []parse.Option
+	var runnerOpts []pipeline.Option
+	if *checkpoint != "" {
+		cp, err := pipeline.LoadCheckpoint(*checkpoint)
+		switch {
+		case err == nil:
+			if err := manager.Restore(cp.Books); err != nil {
+				return err
+			}
+			parserOpts = append(parserOpts, parse.WithOffset(cp.Offset))
+			log.Printf("resuming at offset %d\n", cp.Offset)
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		runnerOpts = append(runnerOpts, pipeline.WithCheckpoint(*checkpoint, 1000))
+	}
+
+	var p parse.FeedParser
+	p, err = newParser(books.format, fs.Args(), parserOpts...)
+	if err != nil {
+		return err
+	}
+	if *speed > 0 || *from != "" {
+		opts := []replay.Option{replay.WithSpeed(*speed)}
+		if *from != "" {
+			t, err := time.Parse(time.RFC3339Nano, *from)
+			if err != nil {
+				return fmt.Errorf("invalid start time: %w", err)
+			}
+			opts = append(opts, replay.WithStart(t))
+		}
+		p = replay.NewReplayer(p, opts...)
+	}
+	return run(ctx, p, manager, runnerOpts...).Err
+}
+
+func serveCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var books bookFlags
+	books.register(fs, "coinbase")
+	var out outputFlags
+	out.register(fs)
+	url := fs.String("url", "wss://ws-feed.exchange.coinbase.com", "websocket feed url")
+	channel := fs.String("channel", "level2", "websocket channel to subscribe to")
+	products := fs.String("products", "BTC-USD", "comma separated products to subscribe to")
+	recordDir := fs.String("record", "", "directory to record the raw messages of the feed to")
+	compression := fs.String("record-compression", "gzip", "compression of the recorded files, one of gzip, zstd, none")
+	maxSize := fs.Int64("record-size", 256<<20, "uncompressed bytes per recorded file")
+	maxAge := fs.Duration("record-interval", time.Hour, "time span per recorded file")
+	flushInterval := fs.Duration("record-flush", time.Second, "interval to write the buffered messages to the recorded file")
+	addr := fs.String("http", "", "address to serve the books as JSON on, e.g. :8080")
+	fs.Parse(args)
+
+	opts, err := out.managerOptions()
+	if err != nil {
+		return err
+	}
+
+	cfg := parse.WebSocketConfig{
+		URL:        *url,
+		Channel:    *channel,
+		ProductIDs: list(*products),
+	}
+	if *recordDir != "" {
+		c, err := record.ParseCompression(*compression)
+		if err != nil {
+			return err
+		}
+		rec, err := record.NewRecorder(*recordDir, books.format, record.WithCompression(c), record.WithMaxSize(*maxSize), record.WithMaxAge(*maxAge))
+		if err != nil {
+			return err
+		}
+		// the messages are buffered, they are flushed periodically so that the file can be read while recording
+		ticker := time.NewTicker(*flushInterval)
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					if err := rec.Flush(); err != nil {
+						log.Println(err)
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+		defer func() {
+			ticker.Stop()
+			close(done)
+			if err := rec.Close(); err != nil {
+				log.Println(err)
+			}
+			log.Printf("recorded %s\n", strings.Join(rec.Files(), ", "))
+		}()
+		cfg.OnMessage = func(received time.Time, msg []byte) {
+			if err := rec.Record(received, msg); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	source := parse.NewWebSocketSource(cfg)
+	// Coinbase sends a snapshot only after subscribing, a book that lost updates resubscribes to receive a fresh one
+	opts = append(opts, feed.WithSynchronizerOptions(feed.WithResyncHandler(source.Reconnect)))
+	manager, err := books.newManager(opts...)
+	if err != nil {
+		source.Close()
+		return err
+	}
+
+	if *addr != "" {
+		srv := &http.Server{
+			Addr:              *addr,
+			Handler:           api.NewHandler(manager),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Println(err)
+			}
+		}()
+		log.Printf("serving books on %s\n", *addr)
+	}
+	// the subscription is sent in the format of the Coinbase feed
+	p, err := parse.NewFeedParser(books.format, source)
+	if err != nil {
+		source.Close()
+		return err
+	}
+	return run(ctx, p, manager).Err
+}
+
+func statsCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var books bookFlags
+	books.register(fs, "json")
+	fs.Parse(args)
+
+	manager, err := books.newManager(feed.WithBackpressure())
+	if err != nil {
+		return err
+	}
+	p, err := newParser(books.format, fs.Args())
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	res := run(ctx, p, manager)
+	elapsed := time.Since(start)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "symbol\tsequence\torders\tbid levels\task levels\tbest bid\tbest ask\tspread\t")
+	manager.Range(func(symbol string, ob *orderbook.ConcurrentOrderBook) bool {
+		stats := ob.Stats()
+		s := ob.Snapshot()
+		instrument := ob.Instrument()
+		bid, ask, spread := "-", "-", "-"
+		if s.Spread.HasBid() {
+			bid = instrument.FormatPrice(s.Spread.HighestBidPrice())
+		}
+		if s.Spread.HasAsk() {
+			ask = instrument.FormatPrice(s.Spread.LowestAskPrice())
+		}
+		if abs, ok := s.Spread.Absolute(); ok {
+			spread = instrument.FormatPrice(abs)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t\n", symbol, stats.Sequence, stats.Orders, stats.BidLevels, stats.AskLevels, bid, ask, spread)
+		return true
+	})
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d updates applied, %d rejected in %v (%.0f updates/s)\n",
+		res.Applied, res.Rejected, elapsed.Round(time.Millisecond), float64(res.Applied+res.Rejected)/elapsed.Seconds())
+	return res.Err
+}
+
+func convertCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("format", "json", "feed format, one of "+strings.Join(parse.Formats, ", "))
+	symbols := fs.String("symbols", "", "comma separated symbols to keep, all if empty")
+	fs.Parse(args)
+
+	p, err := newParser(*format, fs.Args())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	u := &updateWriter{w: w, enc: json.NewEncoder(w), symbols: make(map[string]bool)}
+	for _, s := range list(*symbols) {
+		u.symbols[s] = true
+	}
+	return run(ctx, p, u).Err
+}
+
+// updateWriter writes updates as JSON lines.
+type updateWriter struct {
+	w       *bufio.Writer
+	enc     *json.Encoder
+	symbols map[string]bool // symbols to keep, all if empty
+}
+
+func (u *updateWriter) Apply(update parse.Update) error {
+	if len(u.symbols) > 0 && !u.symbols[update.Symbol] {
+		return nil
+	}
+	return u.enc.Encode(update)
+}
+
+func (u *updateWriter) Flush() error {
+	return u.w.Flush()
+}
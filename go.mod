@@ -1,14 +1,18 @@
 module github.com/fbngrm/crypto-compare
 
-go 1.19
+go 1.22
 
-require github.com/i25959341/orderbook v0.2.5
+require (
+	github.com/emirpasic/gods v1.18.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/i25959341/orderbook v0.2.5
+	github.com/klauspost/compress v1.18.0
+	github.com/shopspring/decimal v1.3.1
+	github.com/stretchr/testify v1.8.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/emirpasic/gods v1.18.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/shopspring/decimal v1.3.1 // indirect
-	github.com/stretchr/testify v1.8.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -2,20 +2,47 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-
-	"github.com/fbngrm/crypto-compare/pkg/orderbook"
-	"github.com/fbngrm/crypto-compare/pkg/parse"
-	"github.com/shopspring/decimal"
+	"strings"
 )
 
+const usage = `usage: crypto-compare <command> [flags] [file ...]
+
+Reads an order book feed from the files, or stdin if there are none or a file is -, and builds a book per symbol.
+
+commands:
+  replay   apply a capture and print the spread after every update
+  serve    apply a live websocket feed, print the spread after every update and serve the books over HTTP
+  stats    apply a capture and print a summary of the books
+  convert  print the normalized updates of a capture as JSON lines
+
+Run crypto-compare <command> -h for the flags of a command.
+`
+
+type command func(ctx context.Context, args []string) error
+
 func main() {
-	input, err := os.Open("./testdata/order-book-data.json")
-	if err != nil {
-		log.Fatal(err)
+	log.SetOutput(os.Stderr)
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	commands := map[string]command{
+		"replay":  replayCmd,
+		"serve":   serveCmd,
+		"stats":   statsCmd,
+		"convert": convertCmd,
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		if flag.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		}
+		flag.Usage()
+		os.Exit(2)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -28,55 +55,15 @@ func main() {
 		cancel()
 	}()
 
-	book := orderbook.NewOrderBook()
-
-	parser := parse.NewJSONStreamParser(input)
-
-	// todo: factor out of main
-	updateCh, errCh := parser.Run(ctx)
-	go func() {
-		for update := range updateCh {
-			id := update.Side + update.Price // todo: use a unique hash here for the ID
-			price, err := decimal.NewFromString(update.Price)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			quantity, err := decimal.NewFromString(update.Quantity)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			// delete zero orders
-			if quantity.String() == "0" {
-				book.CancelOrder(id)
-				continue
-			}
-			side, err := orderbook.NewSide(update.Side)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			err = book.UpdateOrder(id, side, quantity, price)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			b, err := book.GetSpread().MarshalJSON()
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-			fmt.Println(string(b))
-		}
-	}()
-
-	err = <-errCh // we block until the stream is closed or the context is canceled
-	if err != nil {
-		// here we could handle EOF or closed input streams and graceful closing of parser in case of error
-		fmt.Println(err)
+	if err := cmd(ctx, flag.Args()[1:]); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	<-ctx.Done()
-	parser.Close()
+// list is a comma separated flag value.
+func list(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
 }
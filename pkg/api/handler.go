@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fbngrm/crypto-compare/pkg/feed"
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+)
+
+var (
+	ErrNotFound      = errors.New("no such path")
+	ErrUnknownOrder  = errors.New("no order with id")
+	ErrInvalidLevels = errors.New("levels must be a positive integer")
+	ErrBookNotLive   = errors.New("book is not in sync with the feed")
+)
+
+const defaultLevels = 10
+
+// Handler serves the books of a feed.BookManager as JSON:
+//
+//	GET /books                          symbols of all books
+//	GET /books/{symbol}                 all levels of the book
+//	GET /books/{symbol}/top             best bid and ask
+//	GET /books/{symbol}/depth?levels=n  best n levels of each side
+//	GET /books/{symbol}/orders/{id}     a resting order
+//	GET /books/{symbol}/stats           order, level and volume totals
+//
+// Symbols that contain a slash, e.g. XBT/USD of Kraken, are escaped in the path: /books/XBT%2FUSD/top.
+//
+// Errors are returned as {"error":"..."} with status 404 for unknown paths, symbols and orders, 400 for invalid
+// parameters and 503 for books that are not live, e.g. while they wait for a snapshot after they missed updates.
+// The top of book and depth within the depth of the snapshots are read without locking, the full book, orders and
+// stats are read under the write lock of the book.
+type Handler struct {
+	books  *feed.BookManager
+	levels int
+	mux    *http.ServeMux
+}
+
+// NewHandler serves the books of the manager.
+func NewHandler(books *feed.BookManager, opts ...Option) *Handler {
+	h := &Handler{
+		books:  books,
+		levels: defaultLevels,
+		mux:    http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.mux.HandleFunc("GET /books", h.symbols)
+	h.mux.HandleFunc("GET /books/{symbol}", h.book(h.full))
+	h.mux.HandleFunc("GET /books/{symbol}/top", h.book(h.top))
+	h.mux.HandleFunc("GET /books/{symbol}/depth", h.book(h.depth))
+	h.mux.HandleFunc("GET /books/{symbol}/orders/{id}", h.book(h.order))
+	h.mux.HandleFunc("GET /books/{symbol}/stats", h.book(h.stats))
+	// the other paths, the mux would respond in plain text
+	h.mux.HandleFunc("GET /", h.notFound)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, fmt.Errorf("%w: %q", ErrNotFound, r.URL.Path))
+}
+
+type bookHandler func(r *http.Request, symbol string, ob *orderbook.ConcurrentOrderBook) (any, int, error)
+
+// book looks up the book of the symbol in the path and writes the response of fn.
+func (h *Handler) book(fn bookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		symbol := r.PathValue("symbol")
+		ob, ok := h.books.Book(symbol)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%w: %q", feed.ErrUnknownSymbol, symbol))
+			return
+		}
+		if state, _ := h.books.State(symbol); state != feed.Live {
+			writeError(w, http.StatusServiceUnavailable, fmt.Errorf("%w: %q is %s", ErrBookNotLive, symbol, state))
+			return
+		}
+		v, status, err := fn(r, symbol, ob)
+		if err != nil {
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func (h *Handler) symbols(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Symbols []string `json:"symbols"`
+	}{
+		Symbols: h.books.Symbols(),
+	})
+}
+
+type depthResponse struct {
+	Symbol string           `json:"symbol"`
+	Depth  *orderbook.Depth `json:"depth"`
+}
+
+func (h *Handler) full(r *http.Request, symbol string, ob *orderbook.ConcurrentOrderBook) (any, int, error) {
+	return depthResponse{Symbol: symbol, Depth: ob.BookDepth(0)}, http.StatusOK, nil
+}
+
+func (h *Handler) depth(r *http.Request, symbol string, ob *orderbook.ConcurrentOrderBook) (any, int, error) {
+	levels := h.levels
+	if s := r.URL.Query().Get("levels"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("%w: %q", ErrInvalidLevels, s)
+		}
+		levels = n
+	}
+	return depthResponse{Symbol: symbol, Depth: ob.BookDepth(levels)}, http.StatusOK, nil
+}
+
+func (h *Handler) top(r *http.Request, symbol string, ob *orderbook.ConcurrentOrderBook) (any, int, error) {
+	// spread and sequence are read from the same snapshot
+	s := ob.Snapshot()
+	return struct {
+		Symbol   string            `json:"symbol"`
+		Sequence uint64            `json:"sequence"`
+		Spread   *orderbook.Spread `json:"spread"`
+	}{
+		Symbol:   symbol,
+		Sequence: s.Sequence,
+		Spread:   s.Spread,
+	}, http.StatusOK, nil
+}
+
+type order struct {
+	ID          string `json:"id"`
+	Side        string `json:"side"`
+	Type        string `json:"type"`
+	TimeInForce string `json:"timeInForce"`
+	Price       string `json:"price"`
+	Quantity    string `json:"quantity"`
+}
+
+func (h *Handler) order(r *http.Request, symbol string, ob *orderbook.ConcurrentOrderBook) (any, int, error) {
+	id := r.PathValue("id")
+	o, ok := ob.Order(id)
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("%w: %q", ErrUnknownOrder, id)
+	}
+	instrument := ob.Instrument()
+	return struct {
+		Symbol string `json:"symbol"`
+		Order  order  `json:"order"`
+	}{
+		Symbol: symbol,
+		Order: order{
+			ID:          o.ID(),
+			Side:        o.Side().String(),
+			Type:        o.Type().String(),
+			TimeInForce: o.TimeInForce().String(),
+			Price:       instrument.FormatPrice(o.Price()),
+			Quantity:    instrument.FormatQuantity(o.Quantity()),
+		},
+	}, http.StatusOK, nil
+}
+
+func (h *Handler) stats(r *http.Request, symbol string, ob *orderbook.ConcurrentOrderBook) (any, int, error) {
+	return struct {
+		Symbol string           `json:"symbol"`
+		Stats  *orderbook.Stats `json:"stats"`
+	}{
+		Symbol: symbol,
+		Stats:  ob.Stats(),
+	}, http.StatusOK, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{
+		Error: err.Error(),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fbngrm/crypto-compare/pkg/feed"
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newManager(t *testing.T) *feed.BookManager {
+	t.Helper()
+	tick, lot := decimal.RequireFromString("0.01"), decimal.RequireFromString("0.001")
+	m := feed.NewBookManager(func(symbol string) *orderbook.OrderBook {
+		return orderbook.NewOrderBook(orderbook.WithInstrument(orderbook.NewInstrument(symbol, tick, lot)))
+	}, feed.WithDepth(2))
+	levels := []parse.Update{
+		{Side: "buy", Price: "99.5", Quantity: "1.5"},
+		{Side: "buy", Price: "99", Quantity: "2"},
+		{Side: "buy", Price: "98", Quantity: "1"},
+		{Side: "sell", Price: "100", Quantity: "0.25"},
+	}
+	for _, u := range levels {
+		u.Symbol, u.Snapshot, u.Sequence = "BTC-USD", true, 7
+		assert.NoError(t, m.Apply(u))
+	}
+	assert.NoError(t, m.Apply(parse.Update{Symbol: "XBT/USD", Side: "buy", Price: "19455.2", Quantity: "1", Snapshot: true}))
+	// a diff without a snapshot
+	assert.NoError(t, m.Apply(parse.Update{Symbol: "SOL-USD", Side: "buy", Price: "150", Quantity: "1", Sequence: 3}))
+	m.Close()
+	return m
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(newManager(t), WithDefaultLevels(1)))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{
+			name:   "symbols",
+			path:   "/books",
+			status: http.StatusOK,
+			body:   `{"symbols":["BTC-USD","SOL-USD","XBT/USD"]}`,
+		},
+		{
+			name:   "top of book",
+			path:   "/books/BTC-USD/top",
+			status: http.StatusOK,
+			body: `{"symbol":"BTC-USD","sequence":7,"spread":{"highestBidPrice":"99.50","highestBidAmount":"1.500",` +
+				`"lowestAskPrice":"100.00","lowestAskAmount":"0.250","midPrice":"99.750","spread":"0.50",` +
+				`"relativeSpread":"0.00501253"}}`,
+		},
+		{
+			name:   "default depth",
+			path:   "/books/BTC-USD/depth",
+			status: http.StatusOK,
+			body: `{"symbol":"BTC-USD","depth":{"bids":[{"price":"99.50","quantity":"1.500","orders":1}],` +
+				`"asks":[{"price":"100.00","quantity":"0.250","orders":1}]}}`,
+		},
+		{
+			name:   "depth beyond the snapshot",
+			path:   "/books/BTC-USD/depth?levels=3",
+			status: http.StatusOK,
+			body: `{"symbol":"BTC-USD","depth":{"bids":[{"price":"99.50","quantity":"1.500","orders":1},` +
+				`{"price":"99.00","quantity":"2.000","orders":1},{"price":"98.00","quantity":"1.000","orders":1}],` +
+				`"asks":[{"price":"100.00","quantity":"0.250","orders":1}]}}`,
+		},
+		{
+			name:   "full book",
+			path:   "/books/BTC-USD",
+			status: http.StatusOK,
+			body: `{"symbol":"BTC-USD","depth":{"bids":[{"price":"99.50","quantity":"1.500","orders":1},` +
+				`{"price":"99.00","quantity":"2.000","orders":1},{"price":"98.00","quantity":"1.000","orders":1}],` +
+				`"asks":[{"price":"100.00","quantity":"0.250","orders":1}]}}`,
+		},
+		{
+			name:   "order",
+			path:   "/books/BTC-USD/orders/buy99",
+			status: http.StatusOK,
+			body: `{"symbol":"BTC-USD","order":{"id":"buy99","side":"buy","type":"limit","timeInForce":"gtc",` +
+				`"price":"99.00","quantity":"2.000"}}`,
+		},
+		{
+			name:   "stats",
+			path:   "/books/BTC-USD/stats",
+			status: http.StatusOK,
+			body: `{"symbol":"BTC-USD","stats":{"sequence":7,"orders":4,"bidLevels":3,"askLevels":1,` +
+				`"bidVolume":"4.500","askVolume":"0.250"}}`,
+		},
+		{
+			name:   "escaped symbol",
+			path:   "/books/XBT%2FUSD/stats",
+			status: http.StatusOK,
+			body: `{"symbol":"XBT/USD","stats":{"sequence":0,"orders":1,"bidLevels":1,"askLevels":0,` +
+				`"bidVolume":"1.000","askVolume":"0.000"}}`,
+		},
+		{
+			name:   "unknown path",
+			path:   "/book/BTC-USD",
+			status: http.StatusNotFound,
+			body:   `{"error":"no such path: \"/book/BTC-USD\""}`,
+		},
+		{
+			name:   "unknown book path",
+			path:   "/books/BTC-USD/trades",
+			status: http.StatusNotFound,
+			body:   `{"error":"no such path: \"/books/BTC-USD/trades\""}`,
+		},
+		{
+			name:   "unknown symbol",
+			path:   "/books/ETH-USD/top",
+			status: http.StatusNotFound,
+			body:   `{"error":"no book for symbol: \"ETH-USD\""}`,
+		},
+		{
+			name:   "book not live",
+			path:   "/books/SOL-USD/top",
+			status: http.StatusServiceUnavailable,
+			body:   `{"error":"book is not in sync with the feed: \"SOL-USD\" is syncing"}`,
+		},
+		{
+			name:   "unknown order",
+			path:   "/books/BTC-USD/orders/sell101",
+			status: http.StatusNotFound,
+			body:   `{"error":"no order with id: \"sell101\""}`,
+		},
+		{
+			name:   "invalid levels",
+			path:   "/books/BTC-USD/depth?levels=-1",
+			status: http.StatusBadRequest,
+			body:   `{"error":"levels must be a positive integer: \"-1\""}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tc.path)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.True(t, json.Valid(b))
+			assert.JSONEq(t, tc.body, string(b))
+		})
+	}
+}
+
+func TestHandlerMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(newManager(t)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/books/BTC-USD/top", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
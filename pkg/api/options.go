@@ -0,0 +1,11 @@
+package api
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithDefaultLevels sets the levels returned by the depth endpoint without a levels parameter, the default is 10.
+func WithDefaultLevels(n int) Option {
+	return func(h *Handler) {
+		h.levels = n
+	}
+}
@@ -0,0 +1,65 @@
+package feed
+
+import (
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/shopspring/decimal"
+)
+
+// BookState is the state of a synchronized book at a message boundary of the feed.
+type BookState struct {
+	State    State          `json:"state"`
+	Sequence uint64         `json:"sequence"`
+	Orders   []OrderState   `json:"orders"`
+	Buffer   []parse.Update `json:"buffer,omitempty"`
+}
+
+// OrderState is a resting order of a BookState.
+type OrderState struct {
+	ID       string          `json:"id"`
+	Side     string          `json:"side"`
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+// Checkpoint returns the state of the synchronizer and its book. It must only be called between messages, a
+// snapshot that has been applied is completed first.
+func (s *Synchronizer) Checkpoint() (BookState, error) {
+	err := s.Flush()
+
+	orders := s.book.Orders()
+	state := BookState{
+		State:    s.state,
+		Sequence: s.book.Sequence(),
+		Orders:   make([]OrderState, len(orders)),
+		Buffer:   append([]parse.Update(nil), s.buffer...),
+	}
+	for i, o := range orders {
+		state.Orders[i] = OrderState{
+			ID:       o.ID(),
+			Side:     o.Side().String(),
+			Price:    o.Price(),
+			Quantity: o.Quantity(),
+		}
+	}
+	return state, err
+}
+
+// Restore replaces the state of the synchronizer and its book.
+func (s *Synchronizer) Restore(state BookState) error {
+	s.book.Clear()
+	for _, o := range state.Orders {
+		side, err := orderbook.NewSide(o.Side)
+		if err != nil {
+			return err
+		}
+		if err := s.book.AddOrder(o.ID, side, o.Quantity, o.Price); err != nil {
+			return err
+		}
+	}
+	s.book.SetSequence(state.Sequence)
+	s.state = state.State
+	s.buffer = append([]parse.Update(nil), state.Buffer...)
+	s.inSnapshot = false
+	return nil
+}
@@ -0,0 +1,377 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+)
+
+var (
+	ErrUnknownSymbol = errors.New("no book for symbol")
+	ErrMissingSymbol = errors.New("update without symbol")
+	ErrManagerClosed = errors.New("book manager closed")
+	ErrQueueFull     = errors.New("book queue full")
+)
+
+const (
+	defaultQueueSize = 100000
+	defaultDepth     = 50
+)
+
+// BookManager routes the updates of a feed to one order book per symbol. A book is created by the first update of
+// its symbol and is Syncing until a snapshot arrives, e.g. Binance sends diffs before the snapshot. Every book is
+// synchronized and updated on its own goroutine, Apply does not block on a busy symbol unless backpressure is
+// enabled. The updates of a message are queued once the message is complete and applied at once, so readers never
+// see part of a message. A message that does not fit the queue of its book is dropped with ErrQueueFull, the book
+// then waits for a fresh snapshot since it missed updates, see WithResyncHandler to request one. The books can be read concurrently, every message
+// publishes a new snapshot.
+type BookManager struct {
+	newBook       func(symbol string) *orderbook.OrderBook
+	syncOpts      []Option
+	defaultSymbol string
+	queueSize     int
+	backpressure  bool
+	depth         int
+	onError       func(symbol string, err error)
+	onUpdate      func(symbol string, u parse.Update, ob *orderbook.ConcurrentOrderBook)
+	symbols       map[string]bool // symbols to keep, all if empty
+
+	mu     sync.RWMutex
+	books  map[string]*managedBook
+	closed bool
+	wg     sync.WaitGroup
+	// owned by Apply
+	offset int64          // offset of the message in progress
+	open   []*managedBook // books with updates of a message that is not complete yet
+}
+
+type managedBook struct {
+	symbol  string
+	book    *orderbook.ConcurrentOrderBook
+	sync    *Synchronizer
+	updates *queue
+	pending sync.WaitGroup // queued updates that have not been applied yet
+	state   atomic.Int32   // state of the synchronizer after the last write
+	// owned by Apply
+	message  []queued // updates of the message in progress
+	overflow bool     // updates have been dropped, the book needs to be resynced
+}
+
+// NewBookManager creates a manager that uses newBook to create the book of a symbol, e.g. to set its instrument.
+func NewBookManager(newBook func(symbol string) *orderbook.OrderBook, opts ...ManagerOption) *BookManager {
+	m := &BookManager{
+		newBook:   newBook,
+		queueSize: defaultQueueSize,
+		depth:     defaultDepth,
+		books:     make(map[string]*managedBook),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Apply queues the update for the book of its symbol, the book is created by the first update of the symbol.
+// Updates without a symbol belong to the default symbol, updates of symbols that are filtered out are dropped.
+// It must not be called concurrently. Errors of the synchronizer are reported to the error handler since the
+// update is applied asynchronously.
+func (m *BookManager) Apply(u parse.Update) error {
+	if u.Symbol == "" {
+		u.Symbol = m.defaultSymbol
+	}
+	if u.Symbol == "" {
+		return ErrMissingSymbol
+	}
+	if len(m.symbols) > 0 && !m.symbols[u.Symbol] {
+		return nil
+	}
+	if err := m.apply(u); err != nil {
+		return fmt.Errorf("%w: %s", err, u.Symbol)
+	}
+	return nil
+}
+
+func (m *BookManager) apply(u parse.Update) error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return ErrManagerClosed
+	}
+	b, ok := m.books[u.Symbol]
+	m.mu.RUnlock()
+	if !ok {
+		// diffs before the first snapshot are buffered by the synchronizer of the new book
+		var err error
+		if b, err = m.create(u.Symbol); err != nil {
+			return err
+		}
+	}
+
+	// queue while holding the read lock so Close cannot close the queues concurrently
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrManagerClosed
+	}
+	if u.Offset != m.offset {
+		// the parser sends all updates of a message before the next one
+		m.completeAll()
+		m.offset = u.Offset
+	}
+	if len(b.message) == 0 {
+		m.open = append(m.open, b)
+	}
+	b.message = append(b.message, queued{update: u})
+	if !u.Last {
+		return nil
+	}
+	m.open = slices.DeleteFunc(m.open, func(o *managedBook) bool { return o == b })
+	return m.complete(b)
+}
+
+// create starts the book of a symbol unless it exists already.
+func (m *BookManager) create(symbol string) (*managedBook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	if b, ok := m.books[symbol]; ok {
+		return b, nil
+	}
+
+	ob := m.newBook(symbol)
+	b := &managedBook{
+		symbol:  symbol,
+		book:    orderbook.NewConcurrentOrderBook(ob, m.depth),
+		sync:    NewSynchronizer(ob, m.syncOpts...),
+		updates: newQueue(m.queueSize),
+	}
+	m.books[symbol] = b
+	m.wg.Add(1)
+	go m.process(symbol, b)
+	return b, nil
+}
+
+func (m *BookManager) process(symbol string, b *managedBook) {
+	defer m.wg.Done()
+	for {
+		items, ok := b.updates.take()
+		if !ok {
+			break
+		}
+		for len(items) > 0 {
+			n := 1
+			for !items[n-1].end {
+				n++
+			}
+			m.applyMessage(symbol, b, items[:n])
+			b.pending.Add(-n)
+			items = items[n:]
+		}
+	}
+	if err := b.update(b.sync.Flush); err != nil {
+		m.reportError(symbol, err)
+	}
+}
+
+// applyMessage applies the updates of a message with a single write. A snapshot is complete at the end of its
+// message, the buffered diffs are replayed before the book is published.
+func (m *BookManager) applyMessage(symbol string, b *managedBook, message []queued) {
+	var errs []error
+	var last *parse.Update
+	_ = b.update(func() error {
+		for i, q := range message {
+			if q.resync {
+				b.sync.Resync()
+				continue
+			}
+			if err := b.sync.Apply(q.update); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			last = &message[i].update
+		}
+		if last != nil && last.Snapshot {
+			if err := b.sync.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+	for _, err := range errs {
+		m.reportError(symbol, err)
+	}
+	if last != nil && m.onUpdate != nil {
+		m.onUpdate(symbol, *last, b.book)
+	}
+}
+
+// complete queues the message in progress of the book, it returns ErrQueueFull if the message is dropped. The
+// message after a dropped one resyncs the book first. With backpressure it waits until the queue has room instead.
+func (m *BookManager) complete(b *managedBook) error {
+	message := b.message
+	b.message = nil
+	if len(message) == 0 {
+		return nil
+	}
+	message[len(message)-1].end = true
+	if m.backpressure {
+		b.pending.Add(len(message))
+		b.updates.pushWait(message...)
+		return nil
+	}
+
+	if b.overflow {
+		message = append([]queued{{resync: true, end: true}}, message...)
+	}
+	b.pending.Add(len(message))
+	if !b.updates.push(message...) {
+		b.pending.Add(-len(message))
+		b.overflow = true
+		return ErrQueueFull
+	}
+	b.overflow = false
+	return nil
+}
+
+// completeAll queues the messages in progress of all books, e.g. once the next message starts. Dropped messages are
+// reported to the error handler.
+func (m *BookManager) completeAll() {
+	for _, b := range m.open {
+		if err := m.complete(b); err != nil {
+			m.reportError(b.symbol, err)
+		}
+	}
+	m.open = m.open[:0]
+}
+
+func (m *BookManager) reportError(symbol string, err error) {
+	if m.onError != nil {
+		m.onError(symbol, err)
+	}
+}
+
+// Book returns the book of a symbol.
+func (m *BookManager) Book(symbol string) (*orderbook.ConcurrentOrderBook, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.books[symbol]
+	if !ok {
+		return nil, false
+	}
+	return b.book, true
+}
+
+// State returns the state of the synchronizer of a symbol, a book that is not Live may be outdated.
+func (m *BookManager) State(symbol string) (State, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.books[symbol]
+	if !ok {
+		return Syncing, false
+	}
+	return State(b.state.Load()), true
+}
+
+// Symbols returns the symbols of all books in ascending order.
+func (m *BookManager) Symbols() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	symbols := make([]string, 0, len(m.books))
+	for symbol := range m.books {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Range calls fn for every book in ascending order of the symbols until fn returns false.
+func (m *BookManager) Range(fn func(symbol string, ob *orderbook.ConcurrentOrderBook) bool) {
+	for _, symbol := range m.Symbols() {
+		ob, ok := m.Book(symbol)
+		if !ok {
+			continue
+		}
+		if !fn(symbol, ob) {
+			return
+		}
+	}
+}
+
+// Checkpoint waits until all queued updates are applied and returns the state of every book. It must not be called
+// concurrently with Apply and only between messages of the feed, so that no book holds part of a message.
+func (m *BookManager) Checkpoint() map[string]BookState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.completeAll()
+
+	states := make(map[string]BookState, len(m.books))
+	for symbol, b := range m.books {
+		b.pending.Wait()
+		var state BookState
+		err := b.update(func() error {
+			if b.overflow {
+				b.overflow = false
+				b.sync.Resync()
+			}
+			var err error
+			state, err = b.sync.Checkpoint()
+			return err
+		})
+		if err != nil {
+			// e.g. a gap in the buffered diffs, the state is valid nevertheless
+			m.reportError(symbol, err)
+		}
+		states[symbol] = state
+	}
+	return states
+}
+
+// Restore creates the books of a checkpoint, e.g. before resuming a feed at the offset of the checkpoint.
+func (m *BookManager) Restore(states map[string]BookState) error {
+	for symbol, state := range states {
+		b, err := m.create(symbol)
+		if err != nil {
+			return err
+		}
+		b.pending.Wait()
+		err = b.update(func() error {
+			return b.sync.Restore(state)
+		})
+		if err != nil {
+			return fmt.Errorf("error restoring %s: %w", symbol, err)
+		}
+	}
+	return nil
+}
+
+// update runs fn with the synchronizer under the write lock of the book and publishes the book and its state.
+func (b *managedBook) update(fn func() error) error {
+	return b.book.Update(func(*orderbook.OrderBook) error {
+		defer func() { b.state.Store(int32(b.sync.State())) }()
+		return fn()
+	})
+}
+
+// Close stops accepting updates and waits until all queued updates are applied.
+func (m *BookManager) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.completeAll()
+	m.closed = true
+	for _, b := range m.books {
+		b.updates.close()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
@@ -0,0 +1,299 @@
+package feed
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func withSymbol(symbol string, updates ...parse.Update) []parse.Update {
+	for i := range updates {
+		updates[i].Symbol = symbol
+	}
+	return updates
+}
+
+func TestBookManager(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	m := NewBookManager(
+		func(symbol string) *orderbook.OrderBook { return orderbook.NewOrderBook() },
+		WithDefaultSymbol("BTC-USD"),
+		WithErrorHandler(func(symbol string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+
+	// a diff before the first snapshot creates the book, it is older than the snapshot
+	var updates []parse.Update
+	updates = append(updates, parse.Update{Symbol: "ETH-USD", Side: "buy", Price: "10", Quantity: "1"})
+	updates = append(updates, snapshot(1, 0, parse.Update{Side: "buy", Price: "99", Quantity: "1"})...)
+	updates = append(updates, withSymbol("ETH-USD", snapshot(2, 0,
+		parse.Update{Side: "buy", Price: "9", Quantity: "2"},
+		parse.Update{Side: "sell", Price: "11", Quantity: "3"},
+	)...)...)
+	updates = append(updates, diff(3, 0, 0, "sell", "100", "1"))
+	updates = append(updates, withSymbol("ETH-USD", diff(4, 0, 0, "buy", "10", "1"))...)
+	for _, u := range updates {
+		assert.NoError(t, m.Apply(u))
+	}
+	m.Close()
+	assert.ErrorIs(t, m.Apply(updates[0]), ErrManagerClosed)
+	assert.Empty(t, errs)
+
+	assert.Equal(t, []string{"BTC-USD", "ETH-USD"}, m.Symbols())
+	btc, ok := m.Book("BTC-USD")
+	assert.True(t, ok)
+	assert.Equal(t, `{{"99.0", "1.0"}, {"100.0", "1.0"}}`, spread(t, btc.GetSpread()))
+	eth, ok := m.Book("ETH-USD")
+	assert.True(t, ok)
+	assert.Equal(t, `{{"10.0", "1.0"}, {"11.0", "3.0"}}`, spread(t, eth.GetSpread()))
+	_, ok = m.Book("XBT/USD")
+	assert.False(t, ok)
+
+	var symbols []string
+	m.Range(func(symbol string, ob *orderbook.ConcurrentOrderBook) bool {
+		symbols = append(symbols, symbol)
+		return false
+	})
+	assert.Equal(t, []string{"BTC-USD"}, symbols)
+}
+
+func TestBookManagerDiffsBeforeSnapshot(t *testing.T) {
+	var errs []error
+	m := NewBookManager(
+		func(symbol string) *orderbook.OrderBook { return orderbook.NewOrderBook() },
+		WithErrorHandler(func(symbol string, err error) { errs = append(errs, err) }),
+	)
+
+	// Binance sends diffs before the REST snapshot, the first diff covers the snapshot
+	var updates []parse.Update
+	updates = append(updates, withSymbol("BTCUSDT", diff(1, 530, 533, "buy", "10", "2"))...)
+	updates = append(updates, withSymbol("BTCUSDT", snapshot(2, 531,
+		parse.Update{Side: "buy", Price: "10", Quantity: "1"},
+		parse.Update{Side: "sell", Price: "11", Quantity: "1"},
+	)...)...)
+	updates = append(updates, withSymbol("BTCUSDT", diff(3, 534, 535, "sell", "12", "1"))...)
+	assert.NoError(t, m.Apply(updates[0]))
+	m.Checkpoint()
+	state, ok := m.State("BTCUSDT")
+	assert.True(t, ok)
+	assert.Equal(t, Syncing, state)
+	for _, u := range updates[1:] {
+		assert.NoError(t, m.Apply(u))
+	}
+	m.Close()
+
+	assert.Empty(t, errs)
+	state, _ = m.State("BTCUSDT")
+	assert.Equal(t, Live, state)
+	_, ok = m.State("ETHUSDT")
+	assert.False(t, ok)
+	ob, ok := m.Book("BTCUSDT")
+	assert.True(t, ok)
+	assert.Equal(t, `{{"10.0", "2.0"}, {"11.0", "1.0"}}`, spread(t, ob.GetSpread()))
+	assert.Equal(t, uint64(535), ob.Sequence())
+}
+
+func TestBookManagerMessages(t *testing.T) {
+	// orders of the published snapshot seen while the book is written
+	var published []int
+	var book atomic.Pointer[orderbook.ConcurrentOrderBook]
+	m := NewBookManager(func(symbol string) *orderbook.OrderBook {
+		return orderbook.NewOrderBook(orderbook.WithListener(orderbook.ListenerFunc(func(orderbook.Event) {
+			if ob := book.Load(); ob != nil {
+				published = append(published, ob.Snapshot().Orders)
+			}
+		})))
+	}, WithDefaultSymbol("BTC-USD"))
+
+	for _, u := range snapshot(1, 0,
+		parse.Update{Side: "buy", Price: "10", Quantity: "1"},
+		parse.Update{Side: "buy", Price: "9", Quantity: "1"},
+		parse.Update{Side: "sell", Price: "11", Quantity: "1"},
+	) {
+		assert.NoError(t, m.Apply(u))
+	}
+	m.Checkpoint()
+	ob, _ := m.Book("BTC-USD")
+	book.Store(ob)
+
+	// a fresh snapshot, e.g. after a reconnect, is published at once
+	for _, u := range snapshot(2, 0,
+		parse.Update{Side: "buy", Price: "8", Quantity: "1"},
+		parse.Update{Side: "sell", Price: "12", Quantity: "1"},
+	) {
+		assert.NoError(t, m.Apply(u))
+	}
+	m.Close()
+
+	assert.NotEmpty(t, published)
+	for _, orders := range published {
+		assert.Equal(t, 3, orders)
+	}
+	assert.Equal(t, 2, ob.Snapshot().Orders)
+	assert.Equal(t, `{{"8.0", "1.0"}, {"12.0", "1.0"}}`, spread(t, ob.GetSpread()))
+}
+
+func TestBookManagerIsolation(t *testing.T) {
+	// the listener of the slow book blocks its goroutine until it is released
+	release := make(chan struct{})
+	applied := make(chan struct{})
+	m := NewBookManager(func(symbol string) *orderbook.OrderBook {
+		if symbol == "FAST" {
+			return orderbook.NewOrderBook(orderbook.WithListener(orderbook.ListenerFunc(func(e orderbook.Event) {
+				if _, ok := e.(orderbook.OrderAdded); ok {
+					close(applied)
+				}
+			})))
+		}
+		return orderbook.NewOrderBook(orderbook.WithListener(orderbook.ListenerFunc(func(orderbook.Event) {
+			<-release
+		})))
+	})
+
+	assert.NoError(t, m.Apply(withSymbol("SLOW", snapshot(1, 0, parse.Update{Side: "buy", Price: "1", Quantity: "1"})...)[0]))
+	assert.NoError(t, m.Apply(withSymbol("FAST", snapshot(2, 0, parse.Update{Side: "buy", Price: "1", Quantity: "1"})...)[0]))
+
+	select {
+	case <-applied:
+	case <-time.After(time.Second):
+		t.Fatal("the busy book stalled the other book")
+	}
+	close(release)
+	m.Close()
+}
+
+func TestBookManagerQueueFull(t *testing.T) {
+	var resyncs atomic.Int64
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	applied := make(chan struct{}, 10)
+	var once sync.Once
+	m := NewBookManager(
+		func(symbol string) *orderbook.OrderBook {
+			if symbol == "FAST" {
+				return orderbook.NewOrderBook()
+			}
+			// the first update of the slow book blocks its goroutine until it is released
+			return orderbook.NewOrderBook(orderbook.WithListener(orderbook.ListenerFunc(func(orderbook.Event) {
+				once.Do(func() { close(blocked) })
+				<-release
+			})))
+		},
+		WithQueueSize(2),
+		WithSynchronizerOptions(WithResyncHandler(func() { resyncs.Add(1) })),
+		WithUpdateHandler(func(symbol string, u parse.Update, ob *orderbook.ConcurrentOrderBook) {
+			if symbol == "SLOW" {
+				applied <- struct{}{}
+			}
+		}),
+	)
+
+	assert.NoError(t, m.Apply(withSymbol("SLOW", snapshot(1, 0, parse.Update{Side: "buy", Price: "10", Quantity: "1"})...)[0]))
+	<-blocked
+	assert.NoError(t, m.Apply(withSymbol("SLOW", diff(2, 0, 0, "buy", "9", "1"))[0]))
+	assert.NoError(t, m.Apply(withSymbol("SLOW", diff(3, 0, 0, "buy", "8", "1"))[0]))
+	// the queue is full, the message is dropped instead of blocking the other books
+	message := withSymbol("SLOW", diff(4, 0, 0, "buy", "7", "1"), diff(4, 0, 0, "buy", "6", "1"))
+	message[0].Last = false
+	assert.NoError(t, m.Apply(message[0]))
+	assert.ErrorIs(t, m.Apply(message[1]), ErrQueueFull)
+	assert.NoError(t, m.Apply(withSymbol("FAST", snapshot(4, 0, parse.Update{Side: "buy", Price: "1", Quantity: "1"})...)[0]))
+
+	close(release)
+	wait := func(n int) {
+		for i := 0; i < n; i++ {
+			<-applied
+		}
+	}
+	wait(3)
+	// the next message resyncs the book, diffs wait for a fresh snapshot
+	assert.NoError(t, m.Apply(withSymbol("SLOW", diff(5, 0, 0, "buy", "5", "1"))[0]))
+	wait(1)
+	for _, u := range withSymbol("SLOW", snapshot(6, 0,
+		parse.Update{Side: "buy", Price: "4", Quantity: "1"},
+		parse.Update{Side: "sell", Price: "11", Quantity: "1"},
+	)...) {
+		assert.NoError(t, m.Apply(u))
+	}
+	wait(1)
+	assert.NoError(t, m.Apply(withSymbol("SLOW", diff(7, 0, 0, "buy", "3", "1"))[0]))
+	m.Close()
+
+	assert.Equal(t, int64(1), resyncs.Load())
+	slow, _ := m.Book("SLOW")
+	assert.Equal(t, `{{"4.0", "1.0"}, {"11.0", "1.0"}}`, spread(t, slow.GetSpread()))
+	assert.Equal(t, 3, slow.Snapshot().Orders)
+	fast, _ := m.Book("FAST")
+	assert.Equal(t, 1, fast.Snapshot().Orders)
+}
+
+func TestBookManagerBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	m := NewBookManager(
+		func(symbol string) *orderbook.OrderBook {
+			return orderbook.NewOrderBook(orderbook.WithListener(orderbook.ListenerFunc(func(orderbook.Event) {
+				once.Do(func() { <-release })
+			})))
+		},
+		WithQueueSize(1),
+		WithBackpressure(),
+	)
+
+	assert.NoError(t, m.Apply(withSymbol("SLOW", snapshot(1, 0, parse.Update{Side: "buy", Price: "10", Quantity: "1"})...)[0]))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i, price := range []string{"9", "8", "7"} {
+			assert.NoError(t, m.Apply(withSymbol("SLOW", diff(int64(i+2), 0, 0, "buy", price, "1"))[0]))
+		}
+	}()
+	close(release)
+	<-done
+	m.Close()
+
+	// Apply waits for the queue instead of dropping updates
+	slow, _ := m.Book("SLOW")
+	assert.Equal(t, 4, slow.Snapshot().Orders)
+}
+
+func TestBookManagerSymbols(t *testing.T) {
+	var mu sync.Mutex
+	applied := map[string]int{}
+	m := NewBookManager(
+		func(symbol string) *orderbook.OrderBook { return orderbook.NewOrderBook() },
+		WithSymbols("ETH-USD"),
+		WithUpdateHandler(func(symbol string, u parse.Update, ob *orderbook.ConcurrentOrderBook) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, symbol, u.Symbol)
+			applied[symbol]++
+		}),
+	)
+
+	var updates []parse.Update
+	updates = append(updates, withSymbol("BTC-USD", snapshot(1, 0, parse.Update{Side: "buy", Price: "99", Quantity: "1"})...)...)
+	updates = append(updates, withSymbol("ETH-USD", snapshot(2, 0,
+		parse.Update{Side: "buy", Price: "9", Quantity: "2"},
+		parse.Update{Side: "sell", Price: "11", Quantity: "3"},
+	)...)...)
+	updates = append(updates, withSymbol("BTC-USD", diff(3, 0, 0, "sell", "100", "1"))...)
+	updates = append(updates, withSymbol("ETH-USD", diff(4, 0, 0, "buy", "10", "1"))...)
+	for _, u := range updates {
+		assert.NoError(t, m.Apply(u))
+	}
+	m.Close()
+
+	assert.Equal(t, []string{"ETH-USD"}, m.Symbols())
+	// the handler is called once per message
+	assert.Equal(t, map[string]int{"ETH-USD": 2}, applied)
+}
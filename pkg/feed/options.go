@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+)
+
+// Option configures a Synchronizer.
+type Option func(*Synchronizer)
+
+// WithResyncHandler sets a function that is called when a sequence gap is detected or Resync is called,
+// e.g. to request a fresh snapshot. It is called while the book is updated and must not block.
+func WithResyncHandler(fn func()) Option {
+	return func(s *Synchronizer) {
+		s.onResync = fn
+	}
+}
+
+// WithMaxBuffer limits the number of diffs buffered while waiting for a snapshot, the oldest diffs are dropped.
+func WithMaxBuffer(n int) Option {
+	return func(s *Synchronizer) {
+		s.maxBuffer = n
+	}
+}
+
+// ManagerOption configures a BookManager.
+type ManagerOption func(*BookManager)
+
+// WithSynchronizerOptions sets the options of the synchronizer of every book.
+func WithSynchronizerOptions(opts ...Option) ManagerOption {
+	return func(m *BookManager) {
+		m.syncOpts = opts
+	}
+}
+
+// WithDefaultSymbol sets the symbol of updates that do not name one, e.g. feeds of a single product.
+func WithDefaultSymbol(symbol string) ManagerOption {
+	return func(m *BookManager) {
+		m.defaultSymbol = symbol
+	}
+}
+
+// WithQueueSize sets the number of updates that can be queued per book before its messages are dropped and the
+// book is resynced, the default is 100000. A larger message is queued if the queue is empty. The queue only takes
+// memory for the updates it holds.
+func WithQueueSize(n int) ManagerOption {
+	return func(m *BookManager) {
+		m.queueSize = n
+	}
+}
+
+// WithBackpressure lets Apply wait while the queue of a book is full instead of dropping its updates, e.g. to
+// replay a capture without losing updates. A busy book then stalls the feed of all books.
+func WithBackpressure() ManagerOption {
+	return func(m *BookManager) {
+		m.backpressure = true
+	}
+}
+
+// WithDepth sets the number of levels per side held by the snapshots of the books, all levels if n <= 0.
+func WithDepth(n int) ManagerOption {
+	return func(m *BookManager) {
+		m.depth = n
+	}
+}
+
+// WithErrorHandler sets a function that is called with the errors of the synchronizers,
+// e.g. stale updates or sequence gaps.
+func WithErrorHandler(fn func(symbol string, err error)) ManagerOption {
+	return func(m *BookManager) {
+		m.onError = fn
+	}
+}
+
+// WithUpdateHandler sets a function that is called on the goroutine of a book after a message has been applied
+// with its last applied update, e.g. to print the spread. The handlers of different books are called concurrently.
+func WithUpdateHandler(fn func(symbol string, u parse.Update, ob *orderbook.ConcurrentOrderBook)) ManagerOption {
+	return func(m *BookManager) {
+		m.onUpdate = fn
+	}
+}
+
+// WithSymbols keeps only the books of the given symbols, the updates of all other symbols are dropped.
+func WithSymbols(symbols ...string) ManagerOption {
+	return func(m *BookManager) {
+		m.symbols = make(map[string]bool, len(symbols))
+		for _, s := range symbols {
+			m.symbols[s] = true
+		}
+	}
+}
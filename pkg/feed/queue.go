@@ -0,0 +1,88 @@
+package feed
+
+import (
+	"sync"
+
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+)
+
+// queued is an update or a request to resync the book after updates have been dropped. The updates of a message
+// are queued together, the last one ends the message.
+type queued struct {
+	update parse.Update
+	resync bool
+	end    bool
+}
+
+// queue holds the updates of a book until its goroutine takes them. It grows with the updates up to a limit, so
+// that large snapshots do not reserve memory for every book.
+type queue struct {
+	limit int
+
+	mu     sync.Mutex
+	items  []queued
+	closed bool
+	ready  chan struct{} // signalled when items are pushed or the queue is closed
+	taken  chan struct{} // signalled when items are taken
+}
+
+func newQueue(limit int) *queue {
+	return &queue{
+		limit: limit,
+		ready: make(chan struct{}, 1),
+		taken: make(chan struct{}, 1),
+	}
+}
+
+// push appends all items or none if they exceed the limit, items beyond the limit are appended to an empty queue.
+func (q *queue) push(items ...queued) bool {
+	q.mu.Lock()
+	if q.limit > 0 && len(q.items) > 0 && len(q.items)+len(items) > q.limit {
+		q.mu.Unlock()
+		return false
+	}
+	q.items = append(q.items, items...)
+	q.mu.Unlock()
+	signal(q.ready)
+	return true
+}
+
+// pushWait appends the items and waits while the queue is full.
+func (q *queue) pushWait(items ...queued) {
+	for !q.push(items...) {
+		<-q.taken
+	}
+}
+
+// take waits for items and returns all of them, false once the queue is closed and empty.
+func (q *queue) take() ([]queued, bool) {
+	for {
+		q.mu.Lock()
+		items, closed := q.items, q.closed
+		q.items = nil
+		q.mu.Unlock()
+		if len(items) > 0 {
+			signal(q.taken)
+			return items, true
+		}
+		if closed {
+			return nil, false
+		}
+		<-q.ready
+	}
+}
+
+// close lets take return once the remaining items are taken.
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	signal(q.ready)
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
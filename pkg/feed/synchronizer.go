@@ -0,0 +1,203 @@
+package feed
+
+import (
+	"errors"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/shopspring/decimal"
+)
+
+// State of a Synchronizer.
+type State int
+
+const (
+	// Syncing waits for the first snapshot, diffs are buffered.
+	Syncing State = iota
+	// Live applies diffs to the book as they arrive.
+	Live
+	// Resyncing waits for a fresh snapshot after a sequence gap, diffs are buffered.
+	Resyncing
+)
+
+func (s State) String() string {
+	switch s {
+	case Live:
+		return "live"
+	case Resyncing:
+		return "resyncing"
+	}
+	return "syncing"
+}
+
+const defaultMaxBuffer = 100000
+
+// Synchronizer applies the updates of a feed to an order book. Diffs are buffered until a snapshot has been
+// applied, buffered diffs older than the snapshot are discarded and the rest is replayed on top of it.
+// A new snapshot replaces the state of the book. When a sequence gap is detected the book waits for a fresh
+// snapshot, diffs are buffered again and the resync handler is called so a snapshot can be requested.
+type Synchronizer struct {
+	book      *orderbook.OrderBook
+	state     State
+	buffer    []parse.Update
+	maxBuffer int
+	onResync  func()
+	// the snapshot being applied, a snapshot is complete once an update of another message arrives
+	inSnapshot     bool
+	snapshotOffset int64
+	snapshotSeq    uint64
+}
+
+func NewSynchronizer(ob *orderbook.OrderBook, opts ...Option) *Synchronizer {
+	s := &Synchronizer{
+		book:      ob,
+		maxBuffer: defaultMaxBuffer,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Synchronizer) Book() *orderbook.OrderBook {
+	return s.book
+}
+
+func (s *Synchronizer) State() State {
+	return s.state
+}
+
+// Buffered returns the number of diffs waiting for a snapshot.
+func (s *Synchronizer) Buffered() int {
+	return len(s.buffer)
+}
+
+// Apply applies a single update. Stale updates are dropped and returned as orderbook.ErrStaleSequence,
+// a sequence gap is returned as *orderbook.GapError after switching to Resyncing.
+func (s *Synchronizer) Apply(u parse.Update) error {
+	if u.Snapshot {
+		if !s.inSnapshot || u.Offset != s.snapshotOffset {
+			s.startSnapshot(u)
+		}
+		return s.applyLevel(u)
+	}
+
+	if s.inSnapshot {
+		if err := s.Flush(); err != nil {
+			if errors.Is(err, orderbook.ErrSequenceGap) {
+				s.buffer = append(s.buffer, u)
+				return err
+			}
+			// the errors of the buffered diffs are reported with the diff, it is applied regardless
+			return errors.Join(err, s.applyDiff(u))
+		}
+	}
+	if s.state != Live {
+		s.bufferDiff(u)
+		return nil
+	}
+	return s.applyDiff(u)
+}
+
+// Flush completes a snapshot that is being applied and replays the buffered diffs. It is called by Apply for the
+// first diff after a snapshot and needs to be called if the stream ends with a snapshot. Diffs that fail to apply
+// are skipped, their errors are returned joined. The replay stops at a sequence gap.
+func (s *Synchronizer) Flush() error {
+	if !s.inSnapshot {
+		return nil
+	}
+	s.inSnapshot = false
+	s.state = Live
+
+	buffered := s.buffer
+	s.buffer = nil
+	var errs []error
+	for i, u := range buffered {
+		if s.stale(u) {
+			continue
+		}
+		if err := s.applyDiff(u); err != nil {
+			errs = append(errs, err)
+			if errors.Is(err, orderbook.ErrSequenceGap) {
+				// keep the remaining diffs for the next snapshot
+				s.buffer = append(s.buffer, buffered[i+1:]...)
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stale returns true if a buffered diff is older than the snapshot. Diffs without a sequence number are ordered by
+// their offset in the stream.
+func (s *Synchronizer) stale(u parse.Update) bool {
+	if u.Sequence != 0 {
+		return u.Sequence <= s.snapshotSeq
+	}
+	return u.Offset <= s.snapshotOffset
+}
+
+func (s *Synchronizer) startSnapshot(u parse.Update) {
+	s.book.Clear()
+	s.book.SetSequence(u.Sequence)
+	s.inSnapshot = true
+	s.snapshotOffset = u.Offset
+	s.snapshotSeq = u.Sequence
+}
+
+func (s *Synchronizer) applyDiff(u parse.Update) error {
+	if err := s.book.AdvanceSequence(u.FirstSequence, u.Sequence); err != nil {
+		if errors.Is(err, orderbook.ErrSequenceGap) {
+			s.resync()
+			s.bufferDiff(u)
+		}
+		return err
+	}
+	return s.applyLevel(u)
+}
+
+// Resync waits for a fresh snapshot as if a sequence gap had been detected, e.g. after updates have been lost.
+// The book keeps its state until the snapshot arrives.
+func (s *Synchronizer) Resync() {
+	s.inSnapshot = false
+	s.resync()
+}
+
+func (s *Synchronizer) resync() {
+	s.state = Resyncing
+	s.buffer = nil
+	if s.onResync != nil {
+		s.onResync()
+	}
+}
+
+func (s *Synchronizer) bufferDiff(u parse.Update) {
+	if len(s.buffer) >= s.maxBuffer {
+		// the oldest diffs are the first ones to become obsolete by a snapshot
+		s.buffer = s.buffer[1:]
+	}
+	s.buffer = append(s.buffer, u)
+}
+
+// applyLevel sets the quantity of a price level, a level is represented by a single order.
+func (s *Synchronizer) applyLevel(u parse.Update) error {
+	id := u.Side + u.Price // todo: use a unique hash here for the ID
+	price, err := decimal.NewFromString(u.Price)
+	if err != nil {
+		return err
+	}
+	quantity, err := decimal.NewFromString(u.Quantity)
+	if err != nil {
+		return err
+	}
+	// delete zero orders
+	if quantity.IsZero() {
+		s.book.CancelOrder(id)
+		return nil
+	}
+	side, err := orderbook.NewSide(u.Side)
+	if err != nil {
+		return err
+	}
+	return s.book.UpdateOrder(id, side, quantity, price)
+}
@@ -0,0 +1,127 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func snapshot(offset int64, seq uint64, levels ...parse.Update) []parse.Update {
+	for i := range levels {
+		levels[i].Snapshot = true
+		levels[i].Sequence = seq
+		levels[i].Offset = offset
+		levels[i].Last = i == len(levels)-1
+	}
+	return levels
+}
+
+func diff(offset int64, first, last uint64, side, price, quantity string) parse.Update {
+	return parse.Update{
+		Side:          side,
+		Price:         price,
+		Quantity:      quantity,
+		FirstSequence: first,
+		Sequence:      last,
+		Offset:        offset,
+		Last:          true,
+	}
+}
+
+func spread(t *testing.T, s *orderbook.Spread) string {
+	t.Helper()
+	return s.String()
+}
+
+func TestSynchronizer(t *testing.T) {
+	resyncs := 0
+	ob := orderbook.NewOrderBook()
+	s := NewSynchronizer(ob, WithResyncHandler(func() { resyncs++ }))
+	assert.Equal(t, Syncing, s.State())
+
+	// diffs before the snapshot are buffered
+	assert.NoError(t, s.Apply(diff(10, 95, 99, "buy", "99", "3")))
+	assert.NoError(t, s.Apply(diff(20, 100, 102, "buy", "99", "4")))
+	assert.NoError(t, s.Apply(diff(30, 103, 103, "sell", "101", "1")))
+	assert.Equal(t, 3, s.Buffered())
+	assert.Equal(t, `{{"0", "0"}, {"0", "0"}}`, spread(t, ob.GetSpread()))
+
+	for _, u := range snapshot(40, 101,
+		parse.Update{Side: "buy", Price: "99", Quantity: "2"},
+		parse.Update{Side: "sell", Price: "100", Quantity: "1"},
+	) {
+		assert.NoError(t, s.Apply(u))
+	}
+	assert.Equal(t, Syncing, s.State())
+	assert.Equal(t, `{{"99.0", "2.0"}, {"100.0", "1.0"}}`, spread(t, ob.GetSpread()))
+
+	// the first diff after the snapshot completes it, the diff older than the snapshot is discarded
+	assert.NoError(t, s.Apply(diff(50, 104, 104, "sell", "100", "0")))
+	assert.Equal(t, Live, s.State())
+	assert.Equal(t, 0, s.Buffered())
+	assert.Equal(t, uint64(104), ob.Sequence())
+	assert.Equal(t, `{{"99.0", "4.0"}, {"101.0", "1.0"}}`, spread(t, ob.GetSpread()))
+
+	assert.ErrorIs(t, s.Apply(diff(60, 100, 100, "buy", "99", "1")), orderbook.ErrStaleSequence)
+
+	// a gap switches to resyncing
+	err := s.Apply(diff(70, 107, 108, "buy", "98", "1"))
+	assert.ErrorIs(t, err, orderbook.ErrSequenceGap)
+	assert.Equal(t, Resyncing, s.State())
+	assert.Equal(t, 1, resyncs)
+	assert.NoError(t, s.Apply(diff(80, 109, 109, "buy", "98", "2")))
+	assert.Equal(t, 2, s.Buffered())
+
+	// a fresh snapshot replaces the stale state of the book
+	for _, u := range snapshot(90, 108,
+		parse.Update{Side: "buy", Price: "97", Quantity: "1"},
+		parse.Update{Side: "sell", Price: "102", Quantity: "1"},
+	) {
+		assert.NoError(t, s.Apply(u))
+	}
+	assert.NoError(t, s.Flush())
+	assert.Equal(t, Live, s.State())
+	assert.Equal(t, uint64(109), ob.Sequence())
+	assert.Equal(t, `{{"98.0", "2.0"}, {"102.0", "1.0"}}`, spread(t, ob.GetSpread()))
+}
+
+func TestSynchronizerWithoutSequence(t *testing.T) {
+	ob := orderbook.NewOrderBook()
+	s := NewSynchronizer(ob)
+
+	// diffs before the snapshot are discarded by their offset
+	assert.NoError(t, s.Apply(diff(10, 0, 0, "buy", "99", "3")))
+	assert.NoError(t, s.Apply(diff(20, 0, 0, "sell", "101", "1")))
+	for _, u := range snapshot(30, 0,
+		parse.Update{Side: "buy", Price: "99", Quantity: "2"},
+		parse.Update{Side: "sell", Price: "100", Quantity: "1"},
+	) {
+		assert.NoError(t, s.Apply(u))
+	}
+	assert.NoError(t, s.Apply(diff(40, 0, 0, "buy", "98", "1")))
+	assert.Equal(t, Live, s.State())
+	assert.Equal(t, `{{"99.0", "2.0"}, {"100.0", "1.0"}}`, spread(t, ob.GetSpread()))
+	assert.Len(t, ob.Orders(), 3)
+}
+
+func TestSynchronizerFlushErrors(t *testing.T) {
+	ob := orderbook.NewOrderBook()
+	s := NewSynchronizer(ob)
+
+	assert.NoError(t, s.Apply(diff(10, 102, 102, "buy", "x", "1")))
+	assert.NoError(t, s.Apply(diff(20, 103, 103, "buy", "98", "1")))
+	for _, u := range snapshot(30, 101, parse.Update{Side: "buy", Price: "99", Quantity: "2"}) {
+		assert.NoError(t, s.Apply(u))
+	}
+
+	// the invalid buffered diff is reported, the others are applied
+	err := s.Apply(diff(40, 104, 104, "sell", "100", "1"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "x to decimal")
+	assert.Equal(t, Live, s.State())
+	assert.Equal(t, uint64(104), ob.Sequence())
+	assert.Equal(t, `{{"99.0", "2.0"}, {"100.0", "1.0"}}`, spread(t, ob.GetSpread()))
+	assert.Len(t, ob.Orders(), 3)
+}
@@ -5,23 +5,39 @@ import (
 )
 
 type OrderBook struct {
-	orders map[string]*Order
-	asks   *OrderSide
-	bids   *OrderSide
+	orders     map[string]*Order
+	asks       *OrderSide
+	bids       *OrderSide
+	instrument *Instrument
+	matching   bool
+	lastTrade  *Trade
+	trades     uint64 // number of trades executed
+	listeners  []Listener
+	top        *Spread // last published top of book
+	sequence   uint64
+	journal    *Journal
+	lsn        uint64 // log sequence number of the last journaled mutation
 }
 
-func NewOrderBook() *OrderBook {
-	return &OrderBook{
-		orders: make(map[string]*Order),
-		bids:   NewOrderSide(),
-		asks:   NewOrderSide(),
+func NewOrderBook(opts ...Option) *OrderBook {
+	ob := &OrderBook{
+		orders:     make(map[string]*Order),
+		bids:       NewOrderSide(),
+		asks:       NewOrderSide(),
+		instrument: DefaultInstrument(),
 	}
+	for _, opt := range opts {
+		opt(ob)
+	}
+	ob.top = ob.GetSpread()
+	return ob
 }
 
-// IsInvalid returns true if the lowest ask/sell is less than the highest bid/buy.
+// IsInvalid returns true if the order would cross the book, i.e. a bid/buy at or above the lowest ask/sell
+// or an ask/sell below the highest bid/buy.
 func (ob *OrderBook) IsInvalid(o *Order) bool {
 	if o.Side() == BUY { // bid
-		minAsk := ob.asks.MinPriceOrder()
+		minAsk := ob.asks.MinPriceLevel()
 		if minAsk == nil {
 			return false
 		}
@@ -31,7 +47,7 @@ func (ob *OrderBook) IsInvalid(o *Order) bool {
 		return false
 	}
 
-	maxBid := ob.bids.MaxPriceOrder()
+	maxBid := ob.bids.MaxPriceLevel()
 	if maxBid == nil {
 		return false
 	}
@@ -41,74 +57,318 @@ func (ob *OrderBook) IsInvalid(o *Order) bool {
 	return false
 }
 
+// crosses returns true if the order crosses the opposite side of the book, the excluded order is ignored, e.g. the
+// order that is replaced. With matching an ask/sell at the highest bid/buy crosses too, it can be matched.
+func (ob *OrderBook) crosses(o, exclude *Order) bool {
+	levels := ob.bids.Descending
+	if o.Side() == BUY {
+		levels = ob.asks.Ascending
+	}
+	for _, level := range levels(2) {
+		if level.Len() == 1 && level.Head() == exclude {
+			continue
+		}
+		if ob.matching || o.Side() == BUY {
+			return o.crosses(level.Price())
+		}
+		return o.Price().LessThan(level.Price())
+	}
+	return false
+}
+
+// UpdateOrder amends an existing order or adds a new one. If the side of an existing order changes, it is
+// replaced by a new order and loses its time priority.
 func (ob *OrderBook) UpdateOrder(orderID string, side Side, quantity, price decimal.Decimal) error {
-	if o, ok := ob.orders[orderID]; ok {
-		ob.CancelOrder(o.ID())
+	o, ok := ob.orders[orderID]
+	if !ok {
+		return ob.AddOrder(orderID, side, quantity, price)
+	}
+	if o.Side() == side {
+		_, err := ob.AmendOrder(orderID, quantity, price)
+		return err
+	}
+
+	replacement := NewOrder(orderID, side, LIMIT, o.TimeInForce(), quantity, price)
+	crossing, err := ob.check(replacement, o)
+	if err != nil {
+		return err
+	}
+	if err := ob.log(JournalRecord{
+		Op:          JournalUpdate,
+		OrderID:     orderID,
+		Side:        side,
+		Type:        LIMIT,
+		TimeInForce: replacement.TimeInForce(),
+		Quantity:    quantity,
+		Price:       price,
+	}); err != nil {
+		return err
+	}
+	ob.cancel(o)
+	ob.execute(replacement, crossing)
+	ob.publishTopOfBook()
+	return nil
+}
+
+// AmendOrder changes the quantity and price of a resting order. The order keeps its time priority if only the
+// quantity is reduced, it is moved to the end of the queue of its new price level if the price changes or the
+// quantity is increased. The amendment is validated like a new order before the book is modified, if it is
+// rejected the original order stays in place. With matching, an order amended to a crossing price is matched
+// and its trades are returned.
+func (ob *OrderBook) AmendOrder(orderID string, quantity, price decimal.Decimal) ([]Trade, error) {
+	o, ok := ob.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
 	}
-	return ob.AddOrder(orderID, side, quantity, price)
+
+	amended := NewOrder(orderID, o.Side(), LIMIT, o.TimeInForce(), quantity, price)
+	crossing, err := ob.check(amended, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ob.log(JournalRecord{Op: JournalAmend, OrderID: orderID, Quantity: quantity, Price: price}); err != nil {
+		return nil, err
+	}
+
+	amendedEvent := OrderAmended{
+		OrderID:     orderID,
+		Side:        o.Side(),
+		OldPrice:    o.Price(),
+		OldQuantity: o.Quantity(),
+		Price:       price,
+		Quantity:    quantity,
+	}
+
+	var trades []Trade
+	if price.Equal(o.Price()) && quantity.LessThanOrEqual(o.Quantity()) {
+		ob.side(o).Level(o.Price()).Reduce(o, o.Quantity().Sub(quantity))
+	} else {
+		ob.remove(o)
+		trades = ob.match(amended, crossing)
+		if amended.Quantity().Sign() > 0 {
+			ob.insert(amended)
+		}
+		amendedEvent.Quantity = amended.Quantity()
+	}
+	ob.emit(amendedEvent)
+	ob.publishTopOfBook()
+	return trades, nil
 }
 
 func (ob *OrderBook) AddOrder(orderID string, side Side, quantity, price decimal.Decimal) error {
-	if _, ok := ob.orders[orderID]; ok {
-		return ErrOrderExists
+	_, err := ob.ProcessOrder(NewOrder(orderID, side, LIMIT, GTC, quantity, price))
+	return err
+}
+
+// ProcessOrder adds the order to the book. Without matching, orders that would cross the book are rejected with
+// ErrInvalid. With matching, a crossing order is filled against the opposite side and the trades are returned.
+// The remaining quantity of GTC and POST_ONLY limit orders rests in the book, it is cancelled for IOC, FOK and
+// MARKET orders. FOK orders that cannot be filled completely and POST_ONLY orders that would cross the book are
+// rejected without trading.
+func (ob *OrderBook) ProcessOrder(o *Order) ([]Trade, error) {
+	if _, ok := ob.orders[o.ID()]; ok {
+		return nil, ErrOrderExists
+	}
+	crossing, err := ob.check(o, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := ob.log(JournalRecord{
+		Op:          JournalAdd,
+		OrderID:     o.ID(),
+		Side:        o.Side(),
+		Type:        o.Type(),
+		TimeInForce: o.TimeInForce(),
+		Quantity:    o.Quantity(),
+		Price:       o.Price(),
+	}); err != nil {
+		return nil, err
+	}
+	trades := ob.execute(o, crossing)
+	ob.publishTopOfBook()
+	return trades, nil
+}
+
+// check validates the order against the instrument and the current state of the book without modifying it and
+// returns true if the order crosses the book. The excluded order is ignored, e.g. the order that is replaced.
+func (ob *OrderBook) check(o, exclude *Order) (bool, error) {
+	if err := ob.validate(o); err != nil {
+		return false, err
+	}
+
+	crossing := o.Type() == MARKET || ob.crosses(o, exclude)
+	if crossing {
+		if o.TimeInForce() == POST_ONLY {
+			return false, ErrPostOnly
+		}
+		if !ob.matching {
+			if o.Type() == MARKET {
+				return false, ErrNoMatching
+			}
+			return false, ErrInvalid
+		}
+	}
+	if o.TimeInForce() == FOK && !ob.canFill(o) {
+		return false, ErrFillOrKill
+	}
+	return crossing, nil
+}
+
+// execute matches a checked order and rests the remainder.
+func (ob *OrderBook) execute(o *Order, crossing bool) []Trade {
+	trades := ob.match(o, crossing)
+	if o.Quantity().Sign() > 0 && o.rests() {
+		ob.insert(o)
+		ob.emit(OrderAdded{
+			OrderID:  o.ID(),
+			Side:     o.Side(),
+			Price:    o.Price(),
+			Quantity: o.Quantity(),
+		})
+	}
+	return trades
+}
+
+func (ob *OrderBook) validate(o *Order) error {
+	if o.isStop() {
+		return ErrStopOrder
 	}
-	if quantity.Sign() <= 0 {
+	if o.Quantity().Sign() <= 0 {
 		return ErrInvalidQuantity
 	}
-	if price.Sign() <= 0 {
+	if err := ob.instrument.ValidateQuantity(o.Quantity()); err != nil {
+		return err
+	}
+	if o.Type() == MARKET {
+		return nil
+	}
+	if o.Price().Sign() <= 0 {
 		return ErrInvalidPrice
 	}
+	return ob.instrument.ValidatePrice(o.Price())
+}
 
-	o := NewOrder(orderID, side, quantity, price)
-	if ob.IsInvalid(o) {
-		return ErrInvalid
+// insert adds the order to its side of the book.
+func (ob *OrderBook) insert(o *Order) {
+	side := ob.side(o)
+	if side.Level(o.Price()) == nil {
+		defer ob.emit(LevelCreated{Side: o.Side(), Price: o.Price()})
 	}
+	ob.orders[o.ID()] = side.Append(o)
+}
 
-	if side == BUY {
-		ob.orders[orderID] = ob.bids.Append(o)
-	} else {
-		ob.orders[orderID] = ob.asks.Append(o)
+// remove deletes the order from its side of the book.
+func (ob *OrderBook) remove(o *Order) {
+	side := ob.side(o)
+	delete(ob.orders, o.ID())
+	side.Remove(o)
+	if side.Level(o.Price()) == nil {
+		ob.emit(LevelRemoved{Side: o.Side(), Price: o.Price()})
 	}
-	return nil
 }
 
+func (ob *OrderBook) side(o *Order) *OrderSide {
+	if o.Side() == BUY {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// CancelOrder removes the order from the book and returns it, nil if the order does not exist or the cancellation
+// cannot be journaled.
 func (ob *OrderBook) CancelOrder(orderID string) *Order {
-	e, ok := ob.orders[orderID]
+	o, ok := ob.orders[orderID]
 	if !ok {
 		return nil
 	}
+	if err := ob.log(JournalRecord{Op: JournalCancel, OrderID: orderID}); err != nil {
+		return nil
+	}
+	ob.cancel(o)
+	ob.publishTopOfBook()
+	return o
+}
 
-	delete(ob.orders, orderID)
+func (ob *OrderBook) cancel(o *Order) {
+	ob.emit(OrderCancelled{
+		OrderID:  o.ID(),
+		Side:     o.Side(),
+		Price:    o.Price(),
+		Quantity: o.Quantity(),
+	})
+	ob.remove(o)
+}
 
-	if e.Side() == BUY {
-		return ob.bids.Remove(e)
+// Clear removes all orders and resets the sequence number and the last trade, e.g. before a new snapshot is applied.
+// The book is not cleared if it cannot be journaled.
+func (ob *OrderBook) Clear() {
+	if err := ob.log(JournalRecord{Op: JournalClear}); err != nil {
+		return
 	}
-	return ob.asks.Remove(e)
+	ob.orders = make(map[string]*Order)
+	ob.bids = NewOrderSide()
+	ob.asks = NewOrderSide()
+	ob.sequence = 0
+	ob.lastTrade = nil
+	ob.emit(BookCleared{})
+	ob.publishTopOfBook()
+}
+
+// LastTradePrice returns the price of the most recent trade, false if no trade happened yet.
+func (ob *OrderBook) LastTradePrice() (decimal.Decimal, bool) {
+	if ob.lastTrade == nil {
+		return decimal.Zero, false
+	}
+	return ob.lastTrade.Price, true
+}
+
+func (ob *OrderBook) Instrument() *Instrument {
+	return ob.instrument
 }
 
 func (ob *OrderBook) GetSpread() *Spread {
-	lowestAskPrice := "0"
-	lowestAskQuantity := "0"
-	minAsk := ob.asks.MinPriceOrder()
-	if minAsk != nil {
-		lowestAskPrice = minAsk.Price().StringFixed(1)
-		lowestAskQuantity = minAsk.Quantity().StringFixed(1)
+	s := &Spread{
+		priceScale:    ob.instrument.PriceScale(),
+		quantityScale: ob.instrument.QuantityScale(),
+	}
+	if minAsk := ob.asks.MinPriceLevel(); minAsk != nil {
+		s.lowestAskPrice = minAsk.Price()
+		s.lowestAskAmount = minAsk.Volume()
+		s.hasAsk = true
+	}
+	if maxBid := ob.bids.MaxPriceLevel(); maxBid != nil {
+		s.highestBidPrice = maxBid.Price()
+		s.highestBidAmount = maxBid.Volume()
+		s.hasBid = true
 	}
+	return s
+}
 
-	highestBidPrice := "0"
-	highestBidQuantity := "0"
-	maxBid := ob.bids.MaxPriceOrder()
-	if maxBid != nil {
-		highestBidPrice = maxBid.Price().StringFixed(1)
-		highestBidQuantity = maxBid.Quantity().StringFixed(1)
+// Depth returns the best n bid and ask levels, all levels if n <= 0.
+func (ob *OrderBook) Depth(n int) *Depth {
+	return &Depth{
+		Bids:       newDepthLevels(ob.bids.Descending(n)),
+		Asks:       newDepthLevels(ob.asks.Ascending(n)),
+		instrument: ob.instrument,
 	}
+}
 
-	return &Spread{
-		highestBidPrice:  highestBidPrice,
-		highestBidAmount: highestBidQuantity,
-		lowestAskPrice:   lowestAskPrice,
-		lowestAskAmount:  lowestAskQuantity,
+// Orders returns all resting orders, bids by descending and asks by ascending price. The orders of a level are in
+// time priority, adding them to an empty book in this order restores the book.
+func (ob *OrderBook) Orders() []*Order {
+	orders := make([]*Order, 0, len(ob.orders))
+	for _, levels := range [][]*PriceLevel{ob.bids.Descending(0), ob.asks.Ascending(0)} {
+		for _, l := range levels {
+			orders = append(orders, l.Orders()...)
+		}
 	}
+	return orders
+}
+
+// Order returns the resting order with the ID.
+func (ob *OrderBook) Order(orderID string) (*Order, bool) {
+	o, ok := ob.orders[orderID]
+	return o, ok
 }
 
 func (ob *OrderBook) String() string {
@@ -1,6 +1,7 @@
 package orderbook
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/shopspring/decimal"
@@ -212,12 +213,7 @@ func TestGetSpread(t *testing.T) {
 			if err != tc.err {
 				t.Logf("unexpected error: %v", err)
 			}
-			spread, err := ob.GetSpread().MarshalJSON()
-			if err != nil {
-				t.Log(err)
-				t.FailNow()
-			}
-			spreadStr := string(spread)
+			spreadStr := ob.GetSpread().String()
 			res[spreadStr] = spreadStr
 		}
 
@@ -226,3 +222,353 @@ func TestGetSpread(t *testing.T) {
 		}
 	}
 }
+
+func TestPriceLevelAggregation(t *testing.T) {
+	ob := NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", BUY, decimal.NewFromFloat(1.5), decimal.NewFromFloat(99.5)))
+	assert.NoError(t, ob.AddOrder("02", BUY, decimal.NewFromFloat(2.0), decimal.NewFromFloat(99.5)))
+	assert.NoError(t, ob.AddOrder("03", SELL, decimal.NewFromFloat(0.4), decimal.NewFromFloat(100.2)))
+
+	assert.Equal(t, `{{"99.5", "3.5"}, {"100.2", "0.4"}}`, ob.GetSpread().String())
+
+	level := ob.bids.MaxPriceLevel()
+	assert.Equal(t, 2, level.Len())
+	assert.Equal(t, "01", level.Head().ID())
+
+	// removing the first order keeps the level and the remaining volume
+	ob.CancelOrder("01")
+	assert.Equal(t, `{{"99.5", "2.0"}, {"100.2", "0.4"}}`, ob.GetSpread().String())
+	assert.Equal(t, "02", ob.bids.MaxPriceLevel().Head().ID())
+
+	// removing an order that is not queued does not change the count
+	ob.bids.Remove(NewOrder("04", BUY, LIMIT, GTC, decimal.NewFromInt(1), decimal.NewFromFloat(99.5)))
+	assert.Equal(t, 1, ob.bids.Len())
+	assert.Equal(t, "2", ob.bids.MaxPriceLevel().Volume().String())
+
+	ob.CancelOrder("02")
+	assert.Equal(t, 0, ob.bids.Len())
+	assert.Nil(t, ob.bids.MaxPriceLevel())
+	assert.Equal(t, 0, ob.bids.Depth())
+}
+
+func TestDepth(t *testing.T) {
+	ob := NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", BUY, decimal.NewFromFloat(1.5), decimal.NewFromFloat(99.5)))
+	assert.NoError(t, ob.AddOrder("02", BUY, decimal.NewFromFloat(2), decimal.NewFromFloat(99.5)))
+	assert.NoError(t, ob.AddOrder("03", BUY, decimal.NewFromFloat(1), decimal.NewFromFloat(98)))
+	assert.NoError(t, ob.AddOrder("04", BUY, decimal.NewFromFloat(3), decimal.NewFromFloat(97.25)))
+	assert.NoError(t, ob.AddOrder("05", SELL, decimal.NewFromFloat(0.4), decimal.NewFromFloat(100.2)))
+	assert.NoError(t, ob.AddOrder("06", SELL, decimal.NewFromFloat(5), decimal.NewFromFloat(101)))
+
+	b, err := ob.Depth(2).MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"bids":[{"price":"99.5","quantity":"3.5","orders":2},{"price":"98","quantity":"1","orders":1}],`+
+		`"asks":[{"price":"100.2","quantity":"0.4","orders":1},{"price":"101","quantity":"5","orders":1}]}`, string(b))
+
+	depth := ob.Depth(0)
+	assert.Len(t, depth.Bids, 3)
+	assert.Len(t, depth.Asks, 2)
+
+	b, err = NewOrderBook().Depth(5).MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"bids":[],"asks":[]}`, string(b))
+
+	b, err = ob.Stats().MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"sequence":0,"orders":6,"bidLevels":3,"askLevels":2,"bidVolume":"7.5","askVolume":"5.4"}`, string(b))
+
+	o, ok := ob.Order("02")
+	assert.True(t, ok)
+	assert.Equal(t, "2", o.Quantity().String())
+	_, ok = ob.Order("07")
+	assert.False(t, ok)
+}
+
+func TestSpreadJSON(t *testing.T) {
+	ob := NewOrderBook()
+	b, err := ob.GetSpread().MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"highestBidPrice":null,"highestBidAmount":null,"lowestAskPrice":null,"lowestAskAmount":null,`+
+		`"midPrice":null,"spread":null,"relativeSpread":null}`, string(b))
+
+	assert.NoError(t, ob.AddOrder("01", BUY, decimal.NewFromFloat(5.1), decimal.NewFromFloat(99.6)))
+	b, err = ob.GetSpread().MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"highestBidPrice":"99.6","highestBidAmount":"5.1","lowestAskPrice":null,"lowestAskAmount":null,`+
+		`"midPrice":null,"spread":null,"relativeSpread":null}`, string(b))
+
+	assert.NoError(t, ob.AddOrder("02", SELL, decimal.NewFromFloat(1), decimal.NewFromFloat(100)))
+	b, err = ob.GetSpread().MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"highestBidPrice":"99.6","highestBidAmount":"5.1","lowestAskPrice":"100","lowestAskAmount":"1",`+
+		`"midPrice":"99.8","spread":"0.4","relativeSpread":"0.00400802"}`, string(b))
+
+	assert.Equal(t, `{{"99.6", "5.1"}, {"100.0", "1.0"}}`, ob.GetSpread().String())
+
+	// without an instrument the decimals are kept as given
+	ob = NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", BUY, decimal.RequireFromString("0.02465102"), decimal.RequireFromString("20301.47")))
+	b, err = ob.GetSpread().MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"highestBidPrice":"20301.47","highestBidAmount":"0.02465102","lowestAskPrice":null,"lowestAskAmount":null,`+
+		`"midPrice":null,"spread":null,"relativeSpread":null}`, string(b))
+	assert.Equal(t, `{{"20301.47", "0.02465102"}, {"0", "0"}}`, ob.GetSpread().String())
+	b, err = ob.Depth(1).MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"bids":[{"price":"20301.47","quantity":"0.02465102","orders":1}],"asks":[]}`, string(b))
+
+	// the spread is valid JSON inside other documents
+	b, err = json.Marshal(struct {
+		Spread *Spread `json:"spread"`
+	}{ob.GetSpread()})
+	assert.NoError(t, err)
+	assert.True(t, json.Valid(b))
+}
+
+func TestInstrument(t *testing.T) {
+	instrument := NewInstrument("BTC-USD", decimal.RequireFromString("0.01"), decimal.RequireFromString("0.00000001"))
+	ob := NewOrderBook(WithInstrument(instrument))
+
+	assert.NoError(t, ob.AddOrder("01", BUY, decimal.RequireFromString("0.02465102"), decimal.RequireFromString("20301.40")))
+	assert.NoError(t, ob.AddOrder("02", SELL, decimal.RequireFromString("0.12"), decimal.RequireFromString("20302")))
+
+	err := ob.AddOrder("03", BUY, decimal.RequireFromString("1"), decimal.RequireFromString("20300.005"))
+	assert.ErrorIs(t, err, ErrOffTick)
+	assert.ErrorIs(t, err, ErrInvalidPrice)
+	var tickErr *OffTickError
+	assert.ErrorAs(t, err, &tickErr)
+	assert.Equal(t, "0.01", tickErr.TickSize.String())
+
+	err = ob.AddOrder("04", BUY, decimal.RequireFromString("0.000000001"), decimal.RequireFromString("20300"))
+	assert.ErrorIs(t, err, ErrOffLot)
+
+	assert.Equal(t, `{{"20301.40", "0.02465102"}, {"20302.00", "0.12000000"}}`, ob.GetSpread().String())
+}
+
+func TestMatching(t *testing.T) {
+	d := decimal.RequireFromString
+
+	// without matching crossing orders are rejected
+	ob := NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", SELL, d("1"), d("100")))
+	assert.ErrorIs(t, ob.AddOrder("02", BUY, d("1"), d("100")), ErrInvalid)
+	// a sell at the highest bid does not cross
+	assert.NoError(t, ob.AddOrder("03", BUY, d("1"), d("99")))
+	assert.NoError(t, ob.AddOrder("04", SELL, d("1"), d("99")))
+	assert.ErrorIs(t, ob.AddOrder("05", SELL, d("1"), d("98")), ErrInvalid)
+
+	// with matching a sell at the highest bid is matched
+	ob = NewOrderBook(WithMatching())
+	assert.NoError(t, ob.AddOrder("01", BUY, d("1"), d("99")))
+	trades, err := ob.ProcessOrder(NewOrder("02", SELL, LIMIT, GTC, d("1"), d("99")))
+	assert.NoError(t, err)
+	assert.Equal(t, []Trade{
+		{MakerOrderID: "01", TakerOrderID: "02", TakerSide: SELL, Price: d("99"), Quantity: d("1")},
+	}, trades)
+	_, err = ob.ProcessOrder(NewOrder("03", BUY, LIMIT, POST_ONLY, d("1"), d("101")))
+	assert.NoError(t, err)
+	_, err = ob.ProcessOrder(NewOrder("04", SELL, LIMIT, POST_ONLY, d("1"), d("101")))
+	assert.ErrorIs(t, err, ErrPostOnly)
+
+	ob = NewOrderBook(WithMatching())
+	assert.NoError(t, ob.AddOrder("01", SELL, d("1"), d("100")))
+	assert.NoError(t, ob.AddOrder("02", SELL, d("2"), d("100")))
+	assert.NoError(t, ob.AddOrder("03", SELL, d("3"), d("101")))
+	assert.NoError(t, ob.AddOrder("04", BUY, d("1"), d("99")))
+
+	trades, err = ob.ProcessOrder(NewOrder("05", BUY, LIMIT, GTC, d("4"), d("101")))
+	assert.NoError(t, err)
+	assert.Equal(t, []Trade{
+		{MakerOrderID: "01", TakerOrderID: "05", TakerSide: BUY, Price: d("100"), Quantity: d("1")},
+		{MakerOrderID: "02", TakerOrderID: "05", TakerSide: BUY, Price: d("100"), Quantity: d("2")},
+		{MakerOrderID: "03", TakerOrderID: "05", TakerSide: BUY, Price: d("101"), Quantity: d("1")},
+	}, trades)
+
+	// the maker at 101 is partially filled and keeps resting
+	ask := ob.asks.MinPriceLevel()
+	assert.Equal(t, "101", ask.Price().String())
+	assert.Equal(t, "2", ask.Volume().String())
+	assert.Equal(t, "03", ask.Head().ID())
+	assert.Nil(t, ob.CancelOrder("01"))
+
+	price, ok := ob.LastTradePrice()
+	assert.True(t, ok)
+	assert.Equal(t, "101", price.String())
+
+	// the remainder of the taker rests in the book
+	trades, err = ob.ProcessOrder(NewOrder("06", SELL, LIMIT, GTC, d("3"), d("101")))
+	assert.NoError(t, err)
+	assert.Empty(t, trades)
+	trades, err = ob.ProcessOrder(NewOrder("07", SELL, LIMIT, GTC, d("1.5"), d("98")))
+	assert.NoError(t, err)
+	assert.Equal(t, []Trade{
+		{MakerOrderID: "04", TakerOrderID: "07", TakerSide: SELL, Price: d("99"), Quantity: d("1")},
+	}, trades)
+	bid := ob.bids.MaxPriceLevel()
+	assert.Nil(t, bid)
+	assert.Equal(t, "98", ob.asks.MinPriceLevel().Price().String())
+	assert.Equal(t, "0.5", ob.asks.MinPriceLevel().Volume().String())
+}
+
+func TestOrderTypes(t *testing.T) {
+	d := decimal.RequireFromString
+	newBook := func() *OrderBook {
+		ob := NewOrderBook(WithMatching())
+		assert.NoError(t, ob.AddOrder("a1", SELL, d("1"), d("100")))
+		assert.NoError(t, ob.AddOrder("a2", SELL, d("2"), d("101")))
+		assert.NoError(t, ob.AddOrder("b1", BUY, d("1"), d("99")))
+		return ob
+	}
+
+	t.Run("market", func(t *testing.T) {
+		ob := newBook()
+		trades, err := ob.ProcessOrder(NewOrder("m", BUY, MARKET, IOC, d("5"), decimal.Zero))
+		assert.NoError(t, err)
+		assert.Len(t, trades, 2)
+		assert.Nil(t, ob.asks.MinPriceLevel())
+		// the unfilled remainder does not rest
+		assert.Equal(t, "99", ob.bids.MaxPriceLevel().Price().String())
+		assert.Equal(t, 1, ob.bids.Len())
+
+		_, err = NewOrderBook().ProcessOrder(NewOrder("m", BUY, MARKET, IOC, d("1"), decimal.Zero))
+		assert.ErrorIs(t, err, ErrNoMatching)
+	})
+
+	t.Run("immediate or cancel", func(t *testing.T) {
+		ob := newBook()
+		trades, err := ob.ProcessOrder(NewOrder("i", BUY, LIMIT, IOC, d("2"), d("100")))
+		assert.NoError(t, err)
+		assert.Len(t, trades, 1)
+		assert.Equal(t, "101", ob.asks.MinPriceLevel().Price().String())
+		assert.Equal(t, "99", ob.bids.MaxPriceLevel().Price().String())
+	})
+
+	t.Run("fill or kill", func(t *testing.T) {
+		ob := newBook()
+		trades, err := ob.ProcessOrder(NewOrder("f1", BUY, LIMIT, FOK, d("4"), d("101")))
+		assert.ErrorIs(t, err, ErrFillOrKill)
+		assert.Empty(t, trades)
+		assert.Equal(t, "1", ob.asks.MinPriceLevel().Volume().String())
+
+		trades, err = ob.ProcessOrder(NewOrder("f2", BUY, LIMIT, FOK, d("3"), d("101")))
+		assert.NoError(t, err)
+		assert.Len(t, trades, 2)
+		assert.Nil(t, ob.asks.MinPriceLevel())
+	})
+
+	t.Run("post only", func(t *testing.T) {
+		ob := newBook()
+		_, err := ob.ProcessOrder(NewOrder("p1", BUY, LIMIT, POST_ONLY, d("1"), d("100")))
+		assert.ErrorIs(t, err, ErrPostOnly)
+		assert.Equal(t, "1", ob.asks.MinPriceLevel().Volume().String())
+
+		trades, err := ob.ProcessOrder(NewOrder("p2", BUY, LIMIT, POST_ONLY, d("1"), d("99.5")))
+		assert.NoError(t, err)
+		assert.Empty(t, trades)
+		assert.Equal(t, "99.5", ob.bids.MaxPriceLevel().Price().String())
+	})
+}
+
+func TestAmendOrder(t *testing.T) {
+	d := decimal.RequireFromString
+
+	ob := NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", BUY, d("2"), d("99")))
+	assert.NoError(t, ob.AddOrder("02", BUY, d("1"), d("99")))
+	assert.NoError(t, ob.AddOrder("03", SELL, d("1"), d("100")))
+
+	_, err := ob.AmendOrder("xx", d("1"), d("99"))
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	// reducing the quantity keeps the time priority
+	_, err = ob.AmendOrder("01", d("1.5"), d("99"))
+	assert.NoError(t, err)
+	level := ob.bids.MaxPriceLevel()
+	assert.Equal(t, "01", level.Head().ID())
+	assert.Equal(t, "2.5", level.Volume().String())
+
+	// increasing the quantity loses the time priority
+	_, err = ob.AmendOrder("01", d("3"), d("99"))
+	assert.NoError(t, err)
+	assert.Equal(t, "02", level.Head().ID())
+	assert.Equal(t, "4", level.Volume().String())
+
+	// a rejected amendment leaves the order untouched
+	_, err = ob.AmendOrder("02", d("1"), d("100"))
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = ob.AmendOrder("02", d("0"), d("99"))
+	assert.ErrorIs(t, err, ErrInvalidQuantity)
+	assert.Equal(t, "02", level.Head().ID())
+	assert.Equal(t, "4", level.Volume().String())
+
+	// changing the price moves the order to the new level
+	_, err = ob.AmendOrder("02", d("1"), d("98"))
+	assert.NoError(t, err)
+	assert.Equal(t, "3", ob.bids.MaxPriceLevel().Volume().String())
+	assert.Equal(t, 2, ob.bids.Depth())
+
+	// a failed update does not delete the existing order
+	assert.ErrorIs(t, ob.UpdateOrder("03", SELL, d("1"), d("97")), ErrInvalid)
+	assert.Equal(t, "100", ob.asks.MinPriceLevel().Price().String())
+
+	// changing the side is checked against the book without the order itself
+	ob = NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", BUY, d("1"), d("99")))
+	assert.NoError(t, ob.UpdateOrder("01", SELL, d("1"), d("99")))
+	assert.Nil(t, ob.bids.MaxPriceLevel())
+	assert.Equal(t, "99", ob.asks.MinPriceLevel().Price().String())
+
+	ob = NewOrderBook(WithMatching())
+	_, err = ob.ProcessOrder(NewOrder("01", BUY, LIMIT, POST_ONLY, d("1"), d("99")))
+	assert.NoError(t, err)
+	assert.NoError(t, ob.AddOrder("02", BUY, d("1"), d("98")))
+	assert.NoError(t, ob.UpdateOrder("01", SELL, d("1"), d("99")))
+	assert.Equal(t, "98", ob.bids.MaxPriceLevel().Price().String())
+	assert.Equal(t, "99", ob.asks.MinPriceLevel().Price().String())
+
+	// with matching an order amended to a crossing price trades
+	ob = NewOrderBook(WithMatching())
+	assert.NoError(t, ob.AddOrder("01", BUY, d("2"), d("99")))
+	assert.NoError(t, ob.AddOrder("02", SELL, d("1"), d("100")))
+	trades, err := ob.AmendOrder("01", d("2"), d("100"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Trade{
+		{MakerOrderID: "02", TakerOrderID: "01", TakerSide: BUY, Price: d("100"), Quantity: d("1")},
+	}, trades)
+	assert.Equal(t, "100", ob.bids.MaxPriceLevel().Price().String())
+	assert.Equal(t, "1", ob.bids.MaxPriceLevel().Volume().String())
+}
+
+func TestAdvanceSequence(t *testing.T) {
+	var gaps []Event
+	ob := NewOrderBook(WithListener(ListenerFunc(func(e Event) {
+		if _, ok := e.(SequenceGap); ok {
+			gaps = append(gaps, e)
+		}
+	})))
+
+	// unknown sequence
+	assert.NoError(t, ob.AdvanceSequence(0, 0))
+	assert.NoError(t, ob.AdvanceSequence(0, 10))
+	assert.Equal(t, uint64(10), ob.Sequence())
+	// several updates of the same message
+	assert.NoError(t, ob.AdvanceSequence(0, 10))
+	assert.NoError(t, ob.AdvanceSequence(0, 11))
+	assert.ErrorIs(t, ob.AdvanceSequence(0, 9), ErrStaleSequence)
+	assert.Equal(t, uint64(11), ob.Sequence())
+
+	err := ob.AdvanceSequence(0, 13)
+	assert.ErrorIs(t, err, ErrSequenceGap)
+	assert.Equal(t, &GapError{Expected: 12, Received: 13}, err)
+	assert.Equal(t, []Event{SequenceGap{Expected: 12, Received: 13}}, gaps)
+	assert.Equal(t, uint64(11), ob.Sequence())
+
+	// ranges of update IDs may overlap the last applied one
+	assert.NoError(t, ob.AdvanceSequence(8, 15))
+	assert.NoError(t, ob.AdvanceSequence(16, 20))
+	assert.ErrorIs(t, ob.AdvanceSequence(22, 25), ErrSequenceGap)
+	assert.Equal(t, uint64(20), ob.Sequence())
+
+	ob.SetSequence(100)
+	assert.NoError(t, ob.AdvanceSequence(101, 101))
+}
@@ -0,0 +1,332 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+
+	"github.com/shopspring/decimal"
+)
+
+// The binary format of an order book:
+//
+//	magic    "OBK" followed by the format version, one byte
+//	instrument symbol, tick size, lot size, price scale, quantity scale
+//	sequence uvarint
+//	lsn      uvarint log sequence number of the last journaled mutation, since version 2
+//	orders   uvarint count, then id, side, type, time in force, quantity and price of every order,
+//	         bids by descending and asks by ascending price, the orders of a level in time priority
+//	checksum CRC-32 (IEEE) of all preceding bytes, big endian
+//
+// Strings are encoded as uvarint length and bytes, decimals as varint exponent and the coefficient as signed
+// varint or, if it does not fit 63 bits, as a zero marker followed by the length, sign and big endian bytes.
+const (
+	formatMagic   = "OBK"
+	formatVersion = 2
+)
+
+// MarshalBinary encodes the orders, sequence, journal LSN and instrument of the book.
+func (ob *OrderBook) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := ob.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the state of the book with the decoded one. Listeners are not notified.
+func (ob *OrderBook) UnmarshalBinary(data []byte) error {
+	_, err := ob.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo writes the binary encoding of the book to w.
+func (ob *OrderBook) WriteTo(w io.Writer) (int64, error) {
+	var sum checksum
+	bw := bufio.NewWriter(w)
+	e := &encoder{w: io.MultiWriter(bw, &sum)}
+
+	e.bytes([]byte(formatMagic))
+	e.bytes([]byte{formatVersion})
+	e.string(ob.instrument.symbol)
+	e.decimal(ob.instrument.tickSize)
+	e.decimal(ob.instrument.lotSize)
+	e.varint(int64(ob.instrument.priceScale))
+	e.varint(int64(ob.instrument.quantityScale))
+	e.uvarint(ob.sequence)
+	e.uvarint(ob.lsn)
+
+	orders := ob.Orders()
+	e.uvarint(uint64(len(orders)))
+	for _, o := range orders {
+		e.string(o.id)
+		e.bytes([]byte{byte(o.side), byte(o.orderType), byte(o.timeInForce)})
+		e.decimal(o.quantity)
+		e.decimal(o.price)
+	}
+	if e.err != nil {
+		return e.n, e.err
+	}
+
+	var trailer [4]byte
+	binary.BigEndian.PutUint32(trailer[:], sum.sum)
+	n, err := bw.Write(trailer[:])
+	e.n += int64(n)
+	if err != nil {
+		return e.n, err
+	}
+	return e.n, bw.Flush()
+}
+
+// ReadFrom replaces the state of the book with the binary encoding read from r, all versions of the format are
+// supported. The book is not modified if the encoding is invalid, e.g. if an order could not rest in the book, its
+// price or quantity is not positive or not a multiple of the tick or lot size or the bids cross the asks. Listeners
+// are not notified.
+func (ob *OrderBook) ReadFrom(r io.Reader) (int64, error) {
+	var sum checksum
+	d := &decoder{r: bufio.NewReader(r), sum: &sum}
+
+	magic := d.bytes(len(formatMagic) + 1)
+	if d.err != nil {
+		return d.n, d.err
+	}
+	if string(magic[:len(formatMagic)]) != formatMagic {
+		return d.n, fmt.Errorf("%w: unknown magic %q", ErrInvalidFormat, magic[:len(formatMagic)])
+	}
+	version := magic[len(formatMagic)]
+	if version < 1 || version > formatVersion {
+		return d.n, fmt.Errorf("%w: %d", ErrVersion, version)
+	}
+
+	instrument := &Instrument{
+		symbol:   d.string(),
+		tickSize: d.decimal(),
+		lotSize:  d.decimal(),
+	}
+	instrument.priceScale = int32(d.varint())
+	instrument.quantityScale = int32(d.varint())
+	sequence := d.uvarint()
+	var lsn uint64
+	if version >= 2 {
+		lsn = d.uvarint()
+	}
+
+	count := d.uvarint()
+	bids, asks := NewOrderSide(), NewOrderSide()
+	orders := make(map[string]*Order)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		o := &Order{id: d.string()}
+		attrs := d.bytes(3)
+		o.quantity = d.decimal()
+		o.price = d.decimal()
+		if d.err != nil {
+			break
+		}
+		o.side, o.orderType, o.timeInForce = Side(attrs[0]), OrderType(attrs[1]), TimeInForce(attrs[2])
+		if o.side != BUY && o.side != SELL {
+			return d.n, fmt.Errorf("%w: invalid side of order %q", ErrInvalidFormat, o.id)
+		}
+		if o.orderType < LIMIT || o.orderType > STOP_LIMIT {
+			return d.n, fmt.Errorf("%w: invalid type of order %q", ErrInvalidFormat, o.id)
+		}
+		if o.timeInForce < GTC || o.timeInForce > POST_ONLY {
+			return d.n, fmt.Errorf("%w: invalid time in force of order %q", ErrInvalidFormat, o.id)
+		}
+		if !o.rests() {
+			return d.n, fmt.Errorf("%w: order %q of type %s with time in force %s does not rest", ErrInvalidFormat, o.id, o.orderType, o.timeInForce)
+		}
+		if !o.quantity.IsPositive() {
+			return d.n, fmt.Errorf("%w: invalid quantity of order %q", ErrInvalidFormat, o.id)
+		}
+		if !o.price.IsPositive() {
+			return d.n, fmt.Errorf("%w: invalid price of order %q", ErrInvalidFormat, o.id)
+		}
+		if err := instrument.ValidatePrice(o.price); err != nil {
+			return d.n, fmt.Errorf("%w: order %q: %w", ErrInvalidFormat, o.id, err)
+		}
+		if err := instrument.ValidateQuantity(o.quantity); err != nil {
+			return d.n, fmt.Errorf("%w: order %q: %w", ErrInvalidFormat, o.id, err)
+		}
+		if _, ok := orders[o.id]; ok {
+			return d.n, fmt.Errorf("%w: duplicate order %q", ErrInvalidFormat, o.id)
+		}
+		if o.side == BUY {
+			orders[o.id] = bids.Append(o)
+		} else {
+			orders[o.id] = asks.Append(o)
+		}
+	}
+	expected := sum.sum
+	trailer := d.bytes(4)
+	if d.err != nil {
+		return d.n, d.err
+	}
+	if binary.BigEndian.Uint32(trailer) != expected {
+		return d.n, fmt.Errorf("%w: checksum mismatch", ErrInvalidFormat)
+	}
+	if bid, ask := bids.MaxPriceLevel(), asks.MinPriceLevel(); bid != nil && ask != nil && bid.Price().GreaterThan(ask.Price()) {
+		return d.n, fmt.Errorf("%w: crossed book, bid %s above ask %s", ErrInvalidFormat, bid.Price(), ask.Price())
+	}
+
+	ob.instrument = instrument
+	ob.sequence = sequence
+	ob.lsn = lsn
+	ob.orders = orders
+	ob.bids = bids
+	ob.asks = asks
+	ob.top = ob.GetSpread()
+	return d.n, nil
+}
+
+// checksum is an io.Writer that keeps a running CRC-32 of the written bytes.
+type checksum struct {
+	sum uint32
+}
+
+func (c *checksum) Write(p []byte) (int, error) {
+	c.sum = crc32.Update(c.sum, crc32.IEEETable, p)
+	return len(p), nil
+}
+
+// encoder writes the primitives of the format, the first error is kept and stops further writes.
+type encoder struct {
+	w   io.Writer
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err != nil {
+		return
+	}
+	n, err := e.w.Write(b)
+	e.n += int64(n)
+	e.err = err
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.bytes(e.buf[:binary.PutUvarint(e.buf[:], v)])
+}
+
+func (e *encoder) varint(v int64) {
+	e.bytes(e.buf[:binary.PutVarint(e.buf[:], v)])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) decimal(d decimal.Decimal) {
+	e.varint(int64(d.Exponent()))
+	c := d.Coefficient()
+	if c.IsInt64() && c.Int64() != 0 {
+		e.varint(c.Int64())
+		return
+	}
+	// zero and big coefficients
+	e.varint(0)
+	e.uvarint(uint64(len(c.Bytes())))
+	e.bytes([]byte{byte(c.Sign() + 1)})
+	e.bytes(c.Bytes())
+}
+
+// decoder reads the primitives of the format, the first error is kept and all further reads return zero values.
+type decoder struct {
+	r   *bufio.Reader
+	sum *checksum
+	n   int64
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err != nil {
+		return
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	d.err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+}
+
+func (d *decoder) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.n++
+	d.sum.Write([]byte{b})
+	return b, nil
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	b := make([]byte, n)
+	read, err := io.ReadFull(d.r, b)
+	d.n += int64(read)
+	d.sum.Write(b[:read])
+	if err != nil {
+		d.fail(err)
+	}
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+// maxLen limits the length of strings and coefficients so that corrupted lengths do not exhaust memory.
+const maxLen = 1 << 16
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > maxLen {
+		d.fail(fmt.Errorf("string of %d bytes", n))
+		return ""
+	}
+	return string(d.bytes(int(n)))
+}
+
+func (d *decoder) decimal() decimal.Decimal {
+	exp := d.varint()
+	c := d.varint()
+	if c != 0 {
+		return decimal.New(c, int32(exp))
+	}
+	n := d.uvarint()
+	if n > maxLen {
+		d.fail(fmt.Errorf("coefficient of %d bytes", n))
+		return decimal.Zero
+	}
+	sign := d.bytes(1)[0]
+	coef := new(big.Int).SetBytes(d.bytes(int(n)))
+	if sign == 0 {
+		coef.Neg(coef)
+	}
+	return decimal.NewFromBigInt(coef, int32(exp))
+}
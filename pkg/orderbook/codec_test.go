@@ -0,0 +1,175 @@
+package orderbook_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	"github.com/fbngrm/crypto-compare/pkg/feed"
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// replay applies the first n updates of the testdata file to a new book, all if n <= 0.
+func replay(t *testing.T, n int) *orderbook.OrderBook {
+	t.Helper()
+	f, err := os.Open("../../testdata/order-book-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parse.NewJSONStreamParser(f)
+
+	instrument := orderbook.NewInstrument("BTC-USD", decimal.RequireFromString("0.01"), decimal.RequireFromString("0.00000001"))
+	ob := orderbook.NewOrderBook(orderbook.WithInstrument(instrument))
+	s := feed.NewSynchronizer(ob)
+	updateCh, _ := p.Run(context.Background())
+	for u := range updateCh {
+		assert.NoError(t, s.Apply(u))
+		if n--; n == 0 {
+			// stop the parser and drain the updates it sent already
+			p.Close()
+			for range updateCh {
+			}
+			break
+		}
+	}
+	p.Close()
+	assert.NoError(t, s.Flush())
+	ob.SetSequence(4711)
+	return ob
+}
+
+func marshal(t *testing.T, v interface{ MarshalJSON() ([]byte, error) }) string {
+	t.Helper()
+	b, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, n := range []int{6000, 0} {
+		ob := replay(t, n)
+		b, err := ob.MarshalBinary()
+		assert.NoError(t, err)
+
+		restored := orderbook.NewOrderBook()
+		assert.NoError(t, restored.UnmarshalBinary(b))
+		assert.Equal(t, marshal(t, ob.GetSpread()), marshal(t, restored.GetSpread()))
+		assert.Equal(t, marshal(t, ob.Depth(0)), marshal(t, restored.Depth(0)))
+		assert.Equal(t, ob.Instrument(), restored.Instrument())
+		assert.Equal(t, uint64(4711), restored.Sequence())
+
+		// time priority is kept
+		var ids, restoredIDs []string
+		for _, o := range ob.Orders() {
+			ids = append(ids, o.ID())
+		}
+		for _, o := range restored.Orders() {
+			restoredIDs = append(restoredIDs, o.ID())
+		}
+		assert.Equal(t, ids, restoredIDs)
+	}
+}
+
+func TestBinaryFormat(t *testing.T) {
+	ob := orderbook.NewOrderBook()
+	assert.NoError(t, ob.AddOrder("1", orderbook.BUY, decimal.RequireFromString("1.5"), decimal.RequireFromString("99")))
+	assert.NoError(t, ob.AddOrder("2", orderbook.BUY, decimal.RequireFromString("2"), decimal.RequireFromString("99")))
+	// a coefficient that does not fit 63 bits
+	huge := decimal.RequireFromString("123456789012345678901234567890.123")
+	assert.NoError(t, ob.AddOrder("3", orderbook.SELL, decimal.RequireFromString("1"), huge))
+
+	var buf bytes.Buffer
+	n, err := ob.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	b := buf.Bytes()
+	assert.Equal(t, "OBK\x02", string(b[:4]))
+
+	restored := orderbook.NewOrderBook()
+	n, err = restored.ReadFrom(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(b)), n)
+	assert.True(t, restored.GetSpread().LowestAskPrice().Equal(huge))
+	assert.Equal(t, "3.5", restored.GetSpread().HighestBidAmount().String())
+
+	corrupt := func(fn func(b []byte) []byte) error {
+		c := fn(append([]byte(nil), b...))
+		return orderbook.NewOrderBook().UnmarshalBinary(c)
+	}
+	assert.ErrorIs(t, corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), orderbook.ErrInvalidFormat)
+	assert.ErrorIs(t, corrupt(func(b []byte) []byte { b[3] = 99; return b }), orderbook.ErrVersion)
+	assert.ErrorIs(t, corrupt(func(b []byte) []byte { b[len(b)-6] ^= 1; return b }), orderbook.ErrInvalidFormat)
+	for i := 0; i < len(b); i++ {
+		assert.ErrorIs(t, corrupt(func(b []byte) []byte { return b[:i] }), orderbook.ErrInvalidFormat)
+	}
+
+	// a failed read does not modify the book
+	assert.Error(t, restored.UnmarshalBinary(b[:len(b)-1]))
+	assert.Equal(t, 3, len(restored.Orders()))
+}
+
+func TestBinaryFormatOrders(t *testing.T) {
+	one := decimal.RequireFromString("1")
+	ob := orderbook.NewOrderBook(orderbook.WithInstrument(orderbook.NewInstrument("BTC-USD", one, one)))
+	assert.NoError(t, ob.AddOrder("bid", orderbook.BUY, decimal.RequireFromString("1"), decimal.RequireFromString("99")))
+	assert.NoError(t, ob.AddOrder("ask", orderbook.SELL, decimal.RequireFromString("2"), decimal.RequireFromString("100")))
+	b, err := ob.MarshalBinary()
+	assert.NoError(t, err)
+
+	// id, side, type and time in force, quantity and price of the bid
+	bid := []byte("\x03bid\x01\x00\x00\x00\x02\x00\xc6\x01")
+	tests := []struct {
+		name  string
+		order []byte
+	}{
+		{name: "zero quantity", order: []byte("\x03bid\x01\x00\x00\x00\x00\x00\x01\x00\xc6\x01")},
+		{name: "negative quantity", order: []byte("\x03bid\x01\x00\x00\x00\x01\x00\xc6\x01")},
+		{name: "unknown type", order: []byte("\x03bid\x01\x09\x00\x00\x02\x00\xc6\x01")},
+		{name: "unknown time in force", order: []byte("\x03bid\x01\x00\x09\x00\x02\x00\xc6\x01")},
+		{name: "market order", order: []byte("\x03bid\x01\x01\x00\x00\x02\x00\xc6\x01")},
+		{name: "immediate or cancel", order: []byte("\x03bid\x01\x00\x01\x00\x02\x00\xc6\x01")},
+		{name: "zero price", order: []byte("\x03bid\x01\x00\x00\x00\x02\x00\x00\x00\x01")},
+		{name: "negative price", order: []byte("\x03bid\x01\x00\x00\x00\x02\x00\xc5\x01")},
+		{name: "off tick", order: []byte("\x03bid\x01\x00\x00\x00\x02\x01\xc6\x0f")},
+		{name: "off lot", order: []byte("\x03bid\x01\x00\x00\x01\x1e\x00\xc6\x01")},
+		{name: "crossed book", order: []byte("\x03bid\x01\x00\x00\x00\x02\x00\xca\x01")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, bytes.Contains(b, bid))
+			c := bytes.Replace(b[:len(b)-4], bid, tt.order, 1)
+			// the checksum is valid, the orders are not
+			c = binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c))
+
+			restored := orderbook.NewOrderBook()
+			assert.ErrorIs(t, restored.UnmarshalBinary(c), orderbook.ErrInvalidFormat)
+			assert.Empty(t, restored.Orders())
+		})
+	}
+
+	// a locked book is valid, the ask is at the price of the bid
+	assert.True(t, bytes.Contains(b, []byte("\x00\xc8\x01")))
+	locked := bytes.Replace(b[:len(b)-4], []byte("\x00\xc8\x01"), []byte("\x00\xc6\x01"), 1)
+	locked = binary.BigEndian.AppendUint32(locked, crc32.ChecksumIEEE(locked))
+	assert.NoError(t, orderbook.NewOrderBook().UnmarshalBinary(locked))
+}
+
+func TestBinaryFormatVersion1(t *testing.T) {
+	// written by the first version of the format, it has no journal LSN
+	v1, err := hex.DecodeString("4f424b01074254432d5553440302050204062a020131010000011e03da9a010132000000033200c8019361e3ac")
+	assert.NoError(t, err)
+
+	ob := orderbook.NewOrderBook()
+	assert.NoError(t, ob.UnmarshalBinary(v1))
+	assert.Equal(t, "BTC-USD", ob.Instrument().Symbol())
+	assert.Equal(t, uint64(42), ob.Sequence())
+	assert.Equal(t, uint64(0), ob.LSN())
+	assert.Equal(t, `{"highestBidPrice":"99.01","highestBidAmount":"1.500","lowestAskPrice":"100.00","lowestAskAmount":"0.250","midPrice":"99.505","spread":"0.99","relativeSpread":"0.00994925"}`, marshal(t, ob.GetSpread()))
+}
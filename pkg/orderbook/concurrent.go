@@ -0,0 +1,171 @@
+package orderbook
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/shopspring/decimal"
+)
+
+// Snapshot is an immutable, consistent view of an order book after a write.
+type Snapshot struct {
+	Spread *Spread
+	// Depth holds the best levels up to the depth of the ConcurrentOrderBook.
+	Depth    *Depth
+	Sequence uint64
+	Orders   int
+}
+
+// ConcurrentOrderBook makes an OrderBook safe for a single writer and any number of readers. Writes are serialized
+// and publish a new Snapshot when they are done, readers load the latest snapshot without locking. Readers never
+// see a partially applied write, they may see the book before the write that is in progress.
+type ConcurrentOrderBook struct {
+	mu       sync.Mutex
+	book     *OrderBook
+	depth    int
+	snapshot atomic.Pointer[Snapshot]
+}
+
+// NewConcurrentOrderBook wraps the book, it must not be used directly afterwards. Snapshots hold the best depth
+// levels of each side, all levels if depth <= 0.
+func NewConcurrentOrderBook(ob *OrderBook, depth int) *ConcurrentOrderBook {
+	cb := &ConcurrentOrderBook{
+		book:  ob,
+		depth: depth,
+	}
+	cb.publish()
+	return cb
+}
+
+// Update runs fn with the wrapped book and publishes a single snapshot afterwards, e.g. to apply all levels of a
+// message at once. The book must not be retained by fn.
+func (cb *ConcurrentOrderBook) Update(fn func(ob *OrderBook) error) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	defer cb.publish()
+	return fn(cb.book)
+}
+
+func (cb *ConcurrentOrderBook) publish() {
+	cb.snapshot.Store(&Snapshot{
+		Spread:   cb.book.GetSpread(),
+		Depth:    cb.book.Depth(cb.depth),
+		Sequence: cb.book.Sequence(),
+		Orders:   len(cb.book.orders),
+	})
+}
+
+func (cb *ConcurrentOrderBook) AddOrder(orderID string, side Side, quantity, price decimal.Decimal) error {
+	return cb.Update(func(ob *OrderBook) error {
+		return ob.AddOrder(orderID, side, quantity, price)
+	})
+}
+
+func (cb *ConcurrentOrderBook) UpdateOrder(orderID string, side Side, quantity, price decimal.Decimal) error {
+	return cb.Update(func(ob *OrderBook) error {
+		return ob.UpdateOrder(orderID, side, quantity, price)
+	})
+}
+
+func (cb *ConcurrentOrderBook) AmendOrder(orderID string, quantity, price decimal.Decimal) ([]Trade, error) {
+	var trades []Trade
+	err := cb.Update(func(ob *OrderBook) error {
+		var err error
+		trades, err = ob.AmendOrder(orderID, quantity, price)
+		return err
+	})
+	return trades, err
+}
+
+func (cb *ConcurrentOrderBook) ProcessOrder(o *Order) ([]Trade, error) {
+	var trades []Trade
+	err := cb.Update(func(ob *OrderBook) error {
+		var err error
+		trades, err = ob.ProcessOrder(o)
+		return err
+	})
+	return trades, err
+}
+
+func (cb *ConcurrentOrderBook) CancelOrder(orderID string) *Order {
+	var o *Order
+	_ = cb.Update(func(ob *OrderBook) error {
+		o = ob.CancelOrder(orderID)
+		return nil
+	})
+	return o
+}
+
+func (cb *ConcurrentOrderBook) Clear() {
+	_ = cb.Update(func(ob *OrderBook) error {
+		ob.Clear()
+		return nil
+	})
+}
+
+// Snapshot returns the state of the book after the last completed write.
+func (cb *ConcurrentOrderBook) Snapshot() *Snapshot {
+	return cb.snapshot.Load()
+}
+
+func (cb *ConcurrentOrderBook) GetSpread() *Spread {
+	return cb.Snapshot().Spread
+}
+
+// Depth returns the best n bid and ask levels of the snapshot, all levels of the snapshot if n <= 0.
+// The levels are shared between readers and must not be modified.
+func (cb *ConcurrentOrderBook) Depth(n int) *Depth {
+	d := cb.Snapshot().Depth
+	return &Depth{
+		Bids:       head(d.Bids, n),
+		Asks:       head(d.Asks, n),
+		instrument: d.instrument,
+	}
+}
+
+// BookDepth returns the best n bid and ask levels, all levels if n <= 0. Unlike Depth it is not limited to the
+// depth of the snapshots, levels beyond it are copied from the book under the write lock.
+func (cb *ConcurrentOrderBook) BookDepth(n int) *Depth {
+	if cb.depth <= 0 || (n > 0 && n <= cb.depth) {
+		return cb.Depth(n)
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.book.Depth(n)
+}
+
+// Order returns a copy of the resting order with the ID, it is read from the book under the write lock.
+func (cb *ConcurrentOrderBook) Order(orderID string) (*Order, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	o, ok := cb.book.Order(orderID)
+	if !ok {
+		return nil, false
+	}
+	c := *o
+	c.elem = nil
+	return &c, true
+}
+
+// Stats summarizes the book under the write lock, it visits every price level.
+func (cb *ConcurrentOrderBook) Stats() *Stats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.book.Stats()
+}
+
+func (cb *ConcurrentOrderBook) Sequence() uint64 {
+	return cb.Snapshot().Sequence
+}
+
+// Instrument is immutable and safe to read concurrently.
+func (cb *ConcurrentOrderBook) Instrument() *Instrument {
+	return cb.book.Instrument()
+}
+
+func head(levels []DepthLevel, n int) []DepthLevel {
+	if n <= 0 || n >= len(levels) {
+		return levels
+	}
+	return levels[:n:n]
+}
@@ -0,0 +1,78 @@
+package orderbook
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrentOrderBook is meant to be run with -race.
+func TestConcurrentOrderBook(t *testing.T) {
+	cb := NewConcurrentOrderBook(NewOrderBook(), 5)
+	assert.False(t, cb.GetSpread().HasBid())
+
+	const writes = 1000
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// a snapshot is consistent, the spread matches the depth and the book never crosses
+				s := cb.Snapshot()
+				if s.Spread.HasBid() {
+					assert.True(t, s.Spread.HighestBidPrice().Equal(s.Depth.Bids[0].Price))
+				}
+				if s.Spread.HasBid() && s.Spread.HasAsk() {
+					assert.True(t, s.Spread.HighestBidPrice().LessThan(s.Spread.LowestAskPrice()))
+				}
+				assert.LessOrEqual(t, len(cb.Depth(3).Asks), 3)
+			}
+		}()
+	}
+
+	for i := 0; i < writes; i++ {
+		bid := fmt.Sprintf("b%d", i)
+		ask := fmt.Sprintf("a%d", i)
+		assert.NoError(t, cb.AddOrder(bid, BUY, decimal.NewFromInt(1), decimal.NewFromInt(int64(100-i%10))))
+		assert.NoError(t, cb.AddOrder(ask, SELL, decimal.NewFromInt(1), decimal.NewFromInt(int64(101+i%10))))
+		if i%3 == 0 {
+			assert.NotNil(t, cb.CancelOrder(bid))
+		}
+		assert.NoError(t, cb.Update(func(ob *OrderBook) error {
+			return ob.UpdateOrder(ask, SELL, decimal.NewFromInt(2), decimal.NewFromInt(int64(101+i%10)))
+		}))
+	}
+	close(done)
+	wg.Wait()
+
+	s := cb.Snapshot()
+	assert.Equal(t, writes+writes-(writes+2)/3, s.Orders)
+	assert.Len(t, s.Depth.Bids, 5)
+	assert.Len(t, cb.Depth(2).Bids, 2)
+	assert.Len(t, cb.Depth(0).Bids, 5)
+	// the book holds more levels than the snapshot
+	assert.Len(t, cb.BookDepth(3).Bids, 3)
+	assert.Len(t, cb.BookDepth(0).Bids, 10)
+	assert.Len(t, cb.BookDepth(20).Asks, 10)
+	assert.Equal(t, s.Orders, cb.Stats().Orders)
+	assert.Equal(t, 10, cb.Stats().AskLevels)
+	o, ok := cb.Order("a999")
+	assert.True(t, ok)
+	assert.Equal(t, "2", o.Quantity().String())
+	assert.Equal(t, "100", cb.GetSpread().HighestBidPrice().String())
+	assert.Equal(t, "101", cb.GetSpread().LowestAskPrice().String())
+
+	cb.Clear()
+	assert.Equal(t, 0, cb.Snapshot().Orders)
+	assert.False(t, cb.GetSpread().HasAsk())
+}
@@ -0,0 +1,67 @@
+package orderbook
+
+import (
+	"encoding/json"
+
+	"github.com/shopspring/decimal"
+)
+
+// DepthLevel is a point in time copy of a price level.
+type DepthLevel struct {
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+	Orders   int
+}
+
+// Depth holds the best bid and ask levels of the book, bids are ordered by descending and asks by ascending price.
+type Depth struct {
+	Bids       []DepthLevel
+	Asks       []DepthLevel
+	instrument *Instrument
+}
+
+func newDepthLevels(levels []*PriceLevel) []DepthLevel {
+	dl := make([]DepthLevel, len(levels))
+	for i, l := range levels {
+		dl[i] = DepthLevel{
+			Price:    l.Price(),
+			Quantity: l.Volume(),
+			Orders:   l.Len(),
+		}
+	}
+	return dl
+}
+
+// MarshalJSON formats prices and quantities according to the instrument of the book.
+func (d *Depth) MarshalJSON() ([]byte, error) {
+	type level struct {
+		Price    string `json:"price"`
+		Quantity string `json:"quantity"`
+		Orders   int    `json:"orders"`
+	}
+	type depth struct {
+		Bids []level `json:"bids"`
+		Asks []level `json:"asks"`
+	}
+
+	instrument := d.instrument
+	if instrument == nil {
+		instrument = DefaultInstrument()
+	}
+	format := func(levels []DepthLevel) []level {
+		l := make([]level, len(levels))
+		for i, dl := range levels {
+			l[i] = level{
+				Price:    instrument.FormatPrice(dl.Price),
+				Quantity: instrument.FormatQuantity(dl.Quantity),
+				Orders:   dl.Orders,
+			}
+		}
+		return l
+	}
+
+	return json.Marshal(depth{
+		Bids: format(d.Bids),
+		Asks: format(d.Asks),
+	})
+}
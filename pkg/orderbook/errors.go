@@ -1,10 +1,57 @@
 package orderbook
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
 
 var (
 	ErrInvalid         = errors.New("invalid order")
 	ErrInvalidQuantity = errors.New("invalid order quantity")
 	ErrInvalidPrice    = errors.New("invalid order price")
 	ErrOrderExists     = errors.New("order already exists")
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrOffTick         = errors.New("order price is not a multiple of the tick size")
+	ErrOffLot          = errors.New("order quantity is not a multiple of the lot size")
+	ErrPostOnly        = errors.New("post-only order would cross the book")
+	ErrFillOrKill      = errors.New("fill-or-kill order cannot be filled completely")
+	ErrNoMatching      = errors.New("market orders require matching")
+	ErrStopOrder       = errors.New("stop orders must be added to a trigger book")
+	ErrNotStopOrder    = errors.New("order is not a stop order")
+	ErrInvalidStop     = errors.New("invalid stop price")
+	ErrSequenceGap     = errors.New("sequence gap")
+	ErrStaleSequence   = errors.New("stale sequence")
+	ErrInvalidFormat   = errors.New("invalid order book format")
+	ErrVersion         = errors.New("unsupported order book format version")
+	ErrCorruptJournal  = errors.New("corrupt journal record")
 )
+
+// OffTickError is returned for orders with a price that is not a multiple of the instrument's tick size.
+type OffTickError struct {
+	Price    decimal.Decimal
+	TickSize decimal.Decimal
+}
+
+func (e *OffTickError) Error() string {
+	return fmt.Sprintf("%v: price %s, tick size %s", ErrOffTick, e.Price, e.TickSize)
+}
+
+func (e *OffTickError) Is(target error) bool {
+	return target == ErrOffTick || target == ErrInvalidPrice
+}
+
+// OffLotError is returned for orders with a quantity that is not a multiple of the instrument's lot size.
+type OffLotError struct {
+	Quantity decimal.Decimal
+	LotSize  decimal.Decimal
+}
+
+func (e *OffLotError) Error() string {
+	return fmt.Sprintf("%v: quantity %s, lot size %s", ErrOffLot, e.Quantity, e.LotSize)
+}
+
+func (e *OffLotError) Is(target error) bool {
+	return target == ErrOffLot || target == ErrInvalidQuantity
+}
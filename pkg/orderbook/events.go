@@ -0,0 +1,118 @@
+package orderbook
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// Event is implemented by all events an OrderBook emits to its listeners.
+type Event interface {
+	event()
+}
+
+// Listener receives the events of an OrderBook. It is called synchronously while the book is modified,
+// it must not modify the book itself.
+type Listener interface {
+	OnEvent(e Event)
+}
+
+// ListenerFunc adapts a function to the Listener interface.
+type ListenerFunc func(e Event)
+
+func (f ListenerFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// OrderAdded is emitted when an order starts resting in the book.
+type OrderAdded struct {
+	OrderID  string
+	Side     Side
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+}
+
+// OrderCancelled is emitted when a resting order is removed from the book by a cancel.
+type OrderCancelled struct {
+	OrderID  string
+	Side     Side
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+}
+
+// OrderAmended is emitted when the price or quantity of a resting order changed.
+// Quantity is zero if the amended order was filled completely.
+type OrderAmended struct {
+	OrderID     string
+	Side        Side
+	OldPrice    decimal.Decimal
+	OldQuantity decimal.Decimal
+	Price       decimal.Decimal
+	Quantity    decimal.Decimal
+}
+
+// LevelCreated is emitted when the first order is added at a price.
+type LevelCreated struct {
+	Side  Side
+	Price decimal.Decimal
+}
+
+// LevelRemoved is emitted when the last order at a price is removed.
+type LevelRemoved struct {
+	Side  Side
+	Price decimal.Decimal
+}
+
+// TopOfBookChanged is emitted after an operation changed the price or volume of the best bid or ask.
+type TopOfBookChanged struct {
+	Spread *Spread
+}
+
+// TradeExecuted is emitted for every trade in matching mode.
+type TradeExecuted struct {
+	Trade Trade
+}
+
+// SequenceGap is emitted when updates are missing between the last applied sequence number and an update.
+type SequenceGap struct {
+	Expected uint64
+	Received uint64
+}
+
+// BookCleared is emitted when all orders have been removed from the book at once.
+type BookCleared struct{}
+
+func (OrderAdded) event()       {}
+func (OrderCancelled) event()   {}
+func (OrderAmended) event()     {}
+func (LevelCreated) event()     {}
+func (LevelRemoved) event()     {}
+func (TopOfBookChanged) event() {}
+func (TradeExecuted) event()    {}
+func (SequenceGap) event()      {}
+func (BookCleared) event()      {}
+
+// AddListener registers a listener for all subsequent events of the book. The top of book is tracked from the
+// current state on, it is not tracked without listeners.
+func (ob *OrderBook) AddListener(l Listener) {
+	ob.listeners = append(ob.listeners, l)
+	ob.top = ob.GetSpread()
+}
+
+func (ob *OrderBook) emit(e Event) {
+	for _, l := range ob.listeners {
+		l.OnEvent(e)
+	}
+}
+
+// publishTopOfBook emits a TopOfBookChanged event if the best bid or ask changed since the last call.
+// It is called once at the end of every public operation so listeners do not see intermediate states.
+func (ob *OrderBook) publishTopOfBook() {
+	if len(ob.listeners) == 0 {
+		return
+	}
+	top := ob.GetSpread()
+	if ob.top != nil && ob.top.Equal(top) {
+		return
+	}
+	ob.top = top
+	ob.emit(TopOfBookChanged{Spread: top})
+}
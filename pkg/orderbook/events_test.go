@@ -0,0 +1,78 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	d := decimal.RequireFromString
+
+	var events []Event
+	ob := NewOrderBook(WithMatching(), WithListener(ListenerFunc(func(e Event) {
+		events = append(events, e)
+	})))
+
+	assert.NoError(t, ob.AddOrder("01", SELL, d("1"), d("100")))
+	assert.Equal(t, []Event{
+		LevelCreated{Side: SELL, Price: d("100")},
+		OrderAdded{OrderID: "01", Side: SELL, Price: d("100"), Quantity: d("1")},
+		TopOfBookChanged{Spread: ob.GetSpread()},
+	}, events)
+
+	// an order behind the best ask does not change the top of book
+	events = nil
+	assert.NoError(t, ob.AddOrder("02", SELL, d("1"), d("101")))
+	assert.Len(t, events, 2)
+	assert.IsType(t, LevelCreated{}, events[0])
+	assert.IsType(t, OrderAdded{}, events[1])
+
+	events = nil
+	_, err := ob.AmendOrder("02", d("0.5"), d("101"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{
+		OrderAmended{OrderID: "02", Side: SELL, OldPrice: d("101"), OldQuantity: d("1"), Price: d("101"), Quantity: d("0.5")},
+	}, events)
+
+	events = nil
+	_, err = ob.ProcessOrder(NewOrder("03", BUY, LIMIT, IOC, d("1"), d("100")))
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{
+		TradeExecuted{Trade: Trade{MakerOrderID: "01", TakerOrderID: "03", TakerSide: BUY, Price: d("100"), Quantity: d("1")}},
+		LevelRemoved{Side: SELL, Price: d("100")},
+		TopOfBookChanged{Spread: ob.GetSpread()},
+	}, events)
+
+	events = nil
+	ob.CancelOrder("02")
+	assert.Equal(t, []Event{
+		OrderCancelled{OrderID: "02", Side: SELL, Price: d("101"), Quantity: d("0.5")},
+		LevelRemoved{Side: SELL, Price: d("101")},
+		TopOfBookChanged{Spread: ob.GetSpread()},
+	}, events)
+
+	// rejected orders do not emit events
+	events = nil
+	_, err = ob.ProcessOrder(NewOrder("04", BUY, LIMIT, FOK, d("1"), d("100")))
+	assert.ErrorIs(t, err, ErrFillOrKill)
+	assert.Empty(t, events)
+
+	// a listener added later is notified of changes since it was added
+	ob = NewOrderBook()
+	assert.NoError(t, ob.AddOrder("01", BUY, d("1"), d("99")))
+	events = nil
+	ob.AddListener(ListenerFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	assert.NoError(t, ob.AddOrder("02", BUY, d("1"), d("98")))
+	assert.Len(t, events, 2)
+	assert.NoError(t, ob.AddOrder("03", BUY, d("1"), d("99")))
+	assert.Equal(t, []Event{
+		LevelCreated{Side: BUY, Price: d("98")},
+		OrderAdded{OrderID: "02", Side: BUY, Price: d("98"), Quantity: d("1")},
+		OrderAdded{OrderID: "03", Side: BUY, Price: d("99"), Quantity: d("1")},
+		TopOfBookChanged{Spread: ob.GetSpread()},
+	}, events)
+}
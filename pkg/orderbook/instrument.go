@@ -0,0 +1,104 @@
+package orderbook
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// Instrument describes the market an order book is kept for.
+// Prices must be a multiple of the tick size and quantities a multiple of the lot size,
+// a zero tick or lot size disables the respective check.
+type Instrument struct {
+	symbol        string
+	tickSize      decimal.Decimal
+	lotSize       decimal.Decimal
+	priceScale    int32
+	quantityScale int32
+}
+
+// NewInstrument derives the price and quantity scale used for formatting from the number of decimal places of
+// the tick and lot size.
+func NewInstrument(symbol string, tickSize, lotSize decimal.Decimal) *Instrument {
+	return &Instrument{
+		symbol:        symbol,
+		tickSize:      tickSize,
+		lotSize:       lotSize,
+		priceScale:    scale(tickSize),
+		quantityScale: scale(lotSize),
+	}
+}
+
+// exactScale formats values with the decimal places they were given with.
+const exactScale = -1
+
+// DefaultInstrument does not restrict prices or quantities and formats them with the decimal places they were
+// given with.
+func DefaultInstrument() *Instrument {
+	return NewInstrument("", decimal.Zero, decimal.Zero).WithScale(exactScale, exactScale)
+}
+
+func scale(d decimal.Decimal) int32 {
+	if d.Exponent() >= 0 {
+		return 0
+	}
+	return -d.Exponent()
+}
+
+// WithScale returns a copy of the instrument that formats prices and quantities with the given number of decimal places.
+// A negative scale keeps the decimal places of the values.
+func (i *Instrument) WithScale(priceScale, quantityScale int32) *Instrument {
+	c := *i
+	c.priceScale = priceScale
+	c.quantityScale = quantityScale
+	return &c
+}
+
+func (i *Instrument) Symbol() string {
+	return i.symbol
+}
+
+func (i *Instrument) TickSize() decimal.Decimal {
+	return i.tickSize
+}
+
+func (i *Instrument) LotSize() decimal.Decimal {
+	return i.lotSize
+}
+
+func (i *Instrument) PriceScale() int32 {
+	return i.priceScale
+}
+
+func (i *Instrument) QuantityScale() int32 {
+	return i.quantityScale
+}
+
+func (i *Instrument) FormatPrice(price decimal.Decimal) string {
+	return format(price, i.priceScale)
+}
+
+func (i *Instrument) FormatQuantity(quantity decimal.Decimal) string {
+	return format(quantity, i.quantityScale)
+}
+
+func format(d decimal.Decimal, scale int32) string {
+	if scale < 0 {
+		return d.String()
+	}
+	return d.StringFixed(scale)
+}
+
+// ValidatePrice returns an OffTickError if the price is not a multiple of the tick size.
+func (i *Instrument) ValidatePrice(price decimal.Decimal) error {
+	if i.tickSize.Sign() > 0 && !price.Mod(i.tickSize).IsZero() {
+		return &OffTickError{Price: price, TickSize: i.tickSize}
+	}
+	return nil
+}
+
+// ValidateQuantity returns an OffLotError if the quantity is not a multiple of the lot size.
+func (i *Instrument) ValidateQuantity(quantity decimal.Decimal) error {
+	if i.lotSize.Sign() > 0 && !quantity.Mod(i.lotSize).IsZero() {
+		return &OffLotError{Quantity: quantity, LotSize: i.lotSize}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/shopspring/decimal"
+)
+
+// JournalOp is the mutation recorded by a JournalRecord.
+type JournalOp byte
+
+const (
+	// JournalAdd records ProcessOrder and AddOrder.
+	JournalAdd JournalOp = iota + 1
+	JournalAmend
+	// JournalUpdate records UpdateOrder if it replaces an order of the other side, otherwise UpdateOrder is
+	// recorded as add or amend.
+	JournalUpdate
+	JournalCancel
+	JournalClear
+	// JournalSequence records a change of the sequence number.
+	JournalSequence
+)
+
+func (op JournalOp) String() string {
+	switch op {
+	case JournalAdd:
+		return "add"
+	case JournalAmend:
+		return "amend"
+	case JournalUpdate:
+		return "update"
+	case JournalCancel:
+		return "cancel"
+	case JournalClear:
+		return "clear"
+	case JournalSequence:
+		return "sequence"
+	}
+	return "unknown"
+}
+
+// JournalRecord is a mutation of an order book, the fields not used by the operation are zero.
+type JournalRecord struct {
+	// LSN is the log sequence number, it is assigned by the journal.
+	LSN         uint64
+	Op          JournalOp
+	OrderID     string
+	Side        Side
+	Type        OrderType
+	TimeInForce TimeInForce
+	Quantity    decimal.Decimal
+	Price       decimal.Decimal
+	Sequence    uint64
+}
+
+// The records of a journal are framed by the length and the CRC-32 (IEEE) of the payload, both uint32 big endian.
+// The smallest payload holds the LSN, the attributes, an empty order ID, two decimals and the sequence, so a
+// zero-filled tail, e.g. of a file that was extended but not written before a crash, is not taken as a record.
+const (
+	recordHeaderLen = 8
+	minRecordLen    = 11
+	maxRecordLen    = 1 << 20
+)
+
+var errTornRecord = errors.New("torn journal record")
+
+// Journal is an append-only write-ahead log of order book mutations. A book with a journal records every mutation
+// after it has been validated and before it is applied. The first failed write is kept and fails all further
+// mutations of the book.
+type Journal struct {
+	f   *os.File
+	lsn uint64
+	err error
+}
+
+// OpenJournal opens or creates the journal at path for appending. A torn record at the end of the journal, e.g.
+// after a crash during a write, is truncated. A corrupted record that is followed by data fails with
+// ErrCorruptJournal, the journal is not modified.
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f}
+	valid, err := ReadJournal(f, func(r JournalRecord) error {
+		j.lsn = r.LSN
+		return nil
+	})
+	if err == nil {
+		err = f.Truncate(valid)
+	}
+	if err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// LSN returns the log sequence number of the last record.
+func (j *Journal) LSN() uint64 {
+	return j.lsn
+}
+
+// Err returns the error of the first failed write.
+func (j *Journal) Err() error {
+	return j.err
+}
+
+// Append writes the record with the next log sequence number, or the LSN of the record if it is higher, and
+// returns the assigned LSN. The record survives a crash of the process once Append returns, it survives a crash of
+// the system only after Sync.
+func (j *Journal) Append(r JournalRecord) (uint64, error) {
+	if j.err != nil {
+		return 0, j.err
+	}
+	if r.LSN <= j.lsn {
+		r.LSN = j.lsn + 1
+	}
+
+	var payload bytes.Buffer
+	e := &encoder{w: &payload}
+	e.uvarint(r.LSN)
+	e.bytes([]byte{byte(r.Op), byte(r.Side), byte(r.Type), byte(r.TimeInForce)})
+	e.string(r.OrderID)
+	e.decimal(r.Quantity)
+	e.decimal(r.Price)
+	e.uvarint(r.Sequence)
+
+	record := make([]byte, recordHeaderLen, recordHeaderLen+payload.Len())
+	binary.BigEndian.PutUint32(record[:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	record = append(record, payload.Bytes()...)
+	// a single write so that a crash tears at most the last record
+	if _, err := j.f.Write(record); err != nil {
+		j.err = fmt.Errorf("error writing journal: %w", err)
+		return 0, j.err
+	}
+	j.lsn = r.LSN
+	return r.LSN, nil
+}
+
+// Sync commits the journal to stable storage.
+func (j *Journal) Sync() error {
+	return j.f.Sync()
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// ReadJournal calls fn for every record of the journal and returns the offset after the last valid record. An
+// incomplete or corrupted last record is torn, the journal ends before it and it is not an error. A corrupted record
+// that is followed by data other than zeros returns ErrCorruptJournal.
+func ReadJournal(r io.Reader, fn func(JournalRecord) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var valid int64
+	for {
+		record, n, err := readRecord(br)
+		if errors.Is(err, io.EOF) {
+			return valid, nil
+		}
+		if errors.Is(err, errTornRecord) {
+			// a crash tears at most the last record, the file may be extended by zeros beyond it
+			tail, err := zeros(br)
+			if err != nil {
+				return valid, err
+			}
+			if !tail {
+				return valid, fmt.Errorf("%w at offset %d", ErrCorruptJournal, valid)
+			}
+			return valid, nil
+		}
+		if err != nil {
+			return valid, err
+		}
+		if err := fn(record); err != nil {
+			return valid, err
+		}
+		valid += n
+	}
+}
+
+func readRecord(r *bufio.Reader) (JournalRecord, int64, error) {
+	var record JournalRecord
+	var header [recordHeaderLen]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if n == 0 && errors.Is(err, io.EOF) {
+			return record, 0, io.EOF
+		}
+		return record, 0, errTornRecord
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < minRecordLen || length > maxRecordLen {
+		return record, 0, errTornRecord
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record, 0, errTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return record, 0, errTornRecord
+	}
+
+	d := &decoder{r: bufio.NewReader(bytes.NewReader(payload)), sum: &checksum{}}
+	record.LSN = d.uvarint()
+	attrs := d.bytes(4)
+	record.Op, record.Side, record.Type, record.TimeInForce = JournalOp(attrs[0]), Side(attrs[1]), OrderType(attrs[2]), TimeInForce(attrs[3])
+	record.OrderID = d.string()
+	record.Quantity = d.decimal()
+	record.Price = d.decimal()
+	record.Sequence = d.uvarint()
+	if d.err != nil {
+		// the checksum matched, the record was written by an incompatible version
+		return record, 0, d.err
+	}
+	return record, int64(recordHeaderLen) + int64(length), nil
+}
+
+// zeros returns true if the rest of the stream holds zero bytes only.
+func zeros(r io.Reader) (bool, error) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// Recover rebuilds an order book from a snapshot written by WriteTo, or an empty book if snapshot is nil, and the
+// records of the journal that are newer than the snapshot. The options are applied to the book before, a journal
+// set by WithJournal only records the mutations after the recovery.
+func Recover(snapshot, journal io.Reader, opts ...Option) (*OrderBook, error) {
+	ob := NewOrderBook(opts...)
+	if snapshot != nil {
+		if _, err := ob.ReadFrom(snapshot); err != nil {
+			return nil, fmt.Errorf("error reading snapshot: %w", err)
+		}
+	}
+
+	j := ob.journal
+	ob.journal = nil
+	defer func() { ob.journal = j }()
+
+	_, err := ReadJournal(journal, func(r JournalRecord) error {
+		if r.LSN <= ob.lsn {
+			return nil
+		}
+		if err := ob.replay(r); err != nil {
+			return fmt.Errorf("error replaying journal record %d (%s %s): %w", r.LSN, r.Op, r.OrderID, err)
+		}
+		ob.lsn = r.LSN
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ob, nil
+}
+
+func (ob *OrderBook) replay(r JournalRecord) error {
+	switch r.Op {
+	case JournalAdd:
+		_, err := ob.ProcessOrder(NewOrder(r.OrderID, r.Side, r.Type, r.TimeInForce, r.Quantity, r.Price))
+		return err
+	case JournalAmend:
+		_, err := ob.AmendOrder(r.OrderID, r.Quantity, r.Price)
+		return err
+	case JournalUpdate:
+		return ob.UpdateOrder(r.OrderID, r.Side, r.Quantity, r.Price)
+	case JournalCancel:
+		if ob.CancelOrder(r.OrderID) == nil {
+			return ErrOrderNotFound
+		}
+		return nil
+	case JournalClear:
+		ob.Clear()
+		return nil
+	case JournalSequence:
+		ob.SetSequence(r.Sequence)
+		return nil
+	}
+	return fmt.Errorf("unknown journal operation %d", r.Op)
+}
+
+// log records a mutation before it is applied, it is a no-op for books without a journal.
+func (ob *OrderBook) log(r JournalRecord) error {
+	if ob.journal == nil {
+		return nil
+	}
+	r.LSN = ob.lsn + 1
+	lsn, err := ob.journal.Append(r)
+	if err != nil {
+		return err
+	}
+	ob.lsn = lsn
+	return nil
+}
+
+// LSN returns the log sequence number of the last journaled mutation applied to the book.
+func (ob *OrderBook) LSN() uint64 {
+	return ob.lsn
+}
@@ -0,0 +1,213 @@
+package orderbook_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// state describes the orders and the sequence of a book.
+func state(t *testing.T, ob *orderbook.OrderBook) string {
+	t.Helper()
+	s := marshal(t, ob.Depth(0)) + "\n"
+	for _, o := range ob.Orders() {
+		s += o.ID() + " " + o.Quantity().String() + "@" + o.Price().String() + "\n"
+	}
+	return s + strconv.FormatUint(ob.Sequence(), 10)
+}
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal")
+	j, err := orderbook.OpenJournal(path)
+	assert.NoError(t, err)
+
+	ob := orderbook.NewOrderBook(orderbook.WithMatching(), orderbook.WithJournal(j))
+	assert.NoError(t, ob.AddOrder("b1", orderbook.BUY, d("1"), d("99")))
+	assert.NoError(t, ob.AddOrder("b2", orderbook.BUY, d("2"), d("99")))
+	assert.NoError(t, ob.AddOrder("a1", orderbook.SELL, d("3"), d("101")))
+	// rejected mutations are not journaled
+	assert.Error(t, ob.AddOrder("b1", orderbook.BUY, d("1"), d("98")))
+	assert.Error(t, ob.AddOrder("x", orderbook.BUY, d("-1"), d("98")))
+	assert.Nil(t, ob.CancelOrder("x"))
+	assert.Equal(t, uint64(3), ob.LSN())
+
+	// snapshot in the middle of the journal
+	var snapshot bytes.Buffer
+	_, err = ob.WriteTo(&snapshot)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ob.UpdateOrder("b1", orderbook.BUY, d("0.5"), d("99")))
+	assert.NoError(t, ob.UpdateOrder("b2", orderbook.SELL, d("1"), d("102")))
+	_, err = ob.ProcessOrder(orderbook.NewOrder("t1", orderbook.BUY, orderbook.MARKET, orderbook.IOC, d("2"), decimal.Zero))
+	assert.NoError(t, err)
+	assert.NotNil(t, ob.CancelOrder("b1"))
+	assert.NoError(t, ob.AdvanceSequence(0, 7))
+	assert.NoError(t, ob.AddOrder("b3", orderbook.BUY, d("4"), d("100")))
+	assert.Equal(t, uint64(9), ob.LSN())
+	assert.NoError(t, j.Sync())
+	assert.NoError(t, j.Close())
+
+	// a torn record at the end of the journal
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 20, 1, 2, 3, 4, 5})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	journal, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	expected := state(t, ob)
+
+	recovered, err := orderbook.Recover(bytes.NewReader(snapshot.Bytes()), bytes.NewReader(journal), orderbook.WithMatching())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, state(t, recovered))
+	assert.Equal(t, uint64(9), recovered.LSN())
+
+	// without a snapshot the whole journal is replayed
+	recovered, err = orderbook.Recover(nil, bytes.NewReader(journal), orderbook.WithMatching())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, state(t, recovered))
+
+	// a corrupted last record is ignored
+	corrupted := append([]byte(nil), journal[:len(journal)-9]...)
+	corrupted[len(corrupted)-1] ^= 1
+	recovered, err = orderbook.Recover(nil, bytes.NewReader(corrupted), orderbook.WithMatching())
+	assert.NoError(t, err)
+	assert.Nil(t, recovered.CancelOrder("b3"))
+	assert.Equal(t, uint64(8), recovered.LSN())
+
+	// a zero-filled tail has a matching checksum but no record
+	zeroed := append(append([]byte(nil), journal[:len(journal)-9]...), make([]byte, 16)...)
+	recovered, err = orderbook.Recover(nil, bytes.NewReader(zeroed), orderbook.WithMatching())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, state(t, recovered))
+	assert.Equal(t, uint64(9), recovered.LSN())
+	valid, err := orderbook.ReadJournal(bytes.NewReader(make([]byte, 16)), func(orderbook.JournalRecord) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), valid)
+
+	// reopening truncates the torn record and continues the journal
+	j, err = orderbook.OpenJournal(path)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), j.LSN())
+	recovered, err = orderbook.Recover(bytes.NewReader(snapshot.Bytes()), bytes.NewReader(journal), orderbook.WithMatching(), orderbook.WithJournal(j))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), j.LSN())
+	assert.NotNil(t, recovered.CancelOrder("b3"))
+	assert.NoError(t, j.Close())
+
+	var ops []orderbook.JournalOp
+	f, err = os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	valid, err = orderbook.ReadJournal(f, func(r orderbook.JournalRecord) error {
+		assert.Equal(t, uint64(len(ops)+1), r.LSN)
+		ops = append(ops, r.Op)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []orderbook.JournalOp{
+		orderbook.JournalAdd, orderbook.JournalAdd, orderbook.JournalAdd,
+		orderbook.JournalAmend, orderbook.JournalUpdate, orderbook.JournalAdd, orderbook.JournalCancel,
+		orderbook.JournalSequence, orderbook.JournalAdd, orderbook.JournalCancel,
+	}, ops)
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), valid)
+}
+
+func TestJournalCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := orderbook.OpenJournal(path)
+	assert.NoError(t, err)
+	ob := orderbook.NewOrderBook(orderbook.WithJournal(j))
+	for i, price := range []string{"99", "98", "97", "96"} {
+		assert.NoError(t, ob.AddOrder(strconv.Itoa(i), orderbook.BUY, d("1"), d(price)))
+	}
+	assert.NoError(t, j.Close())
+	journal, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	size := len(journal) / 4
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+		valid   int
+		err     error
+	}{
+		{
+			name:    "first record",
+			corrupt: func(b []byte) []byte { b[size-1] ^= 1; return b },
+			err:     orderbook.ErrCorruptJournal,
+		},
+		{
+			name:    "length of a middle record",
+			corrupt: func(b []byte) []byte { b[size] = 0xff; return b },
+			valid:   size,
+			err:     orderbook.ErrCorruptJournal,
+		},
+		{
+			name:    "last record",
+			corrupt: func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+			valid:   3 * size,
+		},
+		{
+			name:    "zero-filled last record",
+			corrupt: func(b []byte) []byte { clear(b[3*size:]); return b },
+			valid:   3 * size,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupted := tt.corrupt(append([]byte(nil), journal...))
+			valid, err := orderbook.ReadJournal(bytes.NewReader(corrupted), func(orderbook.JournalRecord) error { return nil })
+			assert.Equal(t, int64(tt.valid), valid)
+			assert.ErrorIs(t, err, tt.err)
+
+			// reopening truncates only a torn last record
+			assert.NoError(t, os.WriteFile(path, corrupted, 0o644))
+			j, err := orderbook.OpenJournal(path)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(3), j.LSN())
+				assert.NoError(t, j.Close())
+			}
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			if tt.err != nil {
+				assert.Equal(t, int64(len(journal)), info.Size())
+			} else {
+				assert.Equal(t, int64(tt.valid), info.Size())
+			}
+		})
+	}
+}
+
+func TestJournalWriteError(t *testing.T) {
+	j, err := orderbook.OpenJournal(filepath.Join(t.TempDir(), "journal"))
+	assert.NoError(t, err)
+	ob := orderbook.NewOrderBook(orderbook.WithJournal(j))
+	assert.NoError(t, ob.AddOrder("b1", orderbook.BUY, d("1"), d("99")))
+	assert.NoError(t, j.Close())
+
+	// mutations that cannot be journaled are not applied
+	assert.Error(t, ob.AddOrder("b2", orderbook.BUY, d("1"), d("98")))
+	assert.Nil(t, ob.CancelOrder("b1"))
+	ob.Clear()
+	assert.Len(t, ob.Orders(), 1)
+	assert.Equal(t, uint64(1), ob.LSN())
+	assert.Error(t, j.Err())
+}
@@ -0,0 +1,69 @@
+package orderbook
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// match fills a crossing order against the opposite side of the book in price-time priority until it is filled or
+// does not cross the best opposite price level anymore. Resting orders that get filled completely are removed from the book.
+func (ob *OrderBook) match(o *Order, crossing bool) []Trade {
+	if !crossing {
+		return nil
+	}
+	best := ob.asks.MinPriceLevel
+	if o.Side() == SELL {
+		best = ob.bids.MaxPriceLevel
+	}
+
+	var trades []Trade
+	for o.Quantity().Sign() > 0 {
+		level := best()
+		if level == nil || !o.crosses(level.Price()) {
+			break
+		}
+		for o.Quantity().Sign() > 0 && level.Len() > 0 {
+			maker := level.Head()
+			quantity := decimal.Min(o.Quantity(), maker.Quantity())
+
+			t := Trade{
+				MakerOrderID: maker.ID(),
+				TakerOrderID: o.ID(),
+				TakerSide:    o.Side(),
+				Price:        maker.Price(),
+				Quantity:     quantity,
+			}
+			trades = append(trades, t)
+			ob.lastTrade = &t
+			ob.trades++
+			ob.emit(TradeExecuted{Trade: t})
+
+			o.quantity = o.quantity.Sub(quantity)
+			if quantity.Equal(maker.Quantity()) {
+				ob.remove(maker)
+			} else {
+				level.Reduce(maker, quantity)
+			}
+		}
+	}
+	return trades
+}
+
+// canFill returns true if the opposite side of the book holds enough volume at crossing prices to fill the order completely.
+func (ob *OrderBook) canFill(o *Order) bool {
+	levels := ob.asks.Ascending
+	if o.Side() == SELL {
+		levels = ob.bids.Descending
+	}
+
+	available := decimal.Zero
+	for _, level := range levels(0) {
+		if !o.crosses(level.Price()) {
+			break
+		}
+		available = available.Add(level.Volume())
+		if available.GreaterThanOrEqual(o.Quantity()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package orderbook
+
+// Option configures an OrderBook.
+type Option func(*OrderBook)
+
+// WithInstrument sets the instrument used to validate and format prices and quantities.
+func WithInstrument(i *Instrument) Option {
+	return func(ob *OrderBook) {
+		ob.instrument = i
+	}
+}
+
+// WithMatching enables matching of crossing orders instead of rejecting them.
+func WithMatching() Option {
+	return func(ob *OrderBook) {
+		ob.matching = true
+	}
+}
+
+// WithListener registers a listener for the events of the book.
+func WithListener(l Listener) Option {
+	return func(ob *OrderBook) {
+		ob.AddListener(l)
+	}
+}
+
+// WithJournal records all mutations of the book in the journal before they are applied.
+func WithJournal(j *Journal) Option {
+	return func(ob *OrderBook) {
+		ob.journal = j
+	}
+}
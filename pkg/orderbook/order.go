@@ -1,24 +1,58 @@
 package orderbook
 
 import (
+	"container/list"
 	"fmt"
 
 	"github.com/shopspring/decimal"
 )
 
 type Order struct {
-	id       string
-	side     Side
-	quantity decimal.Decimal
-	price    decimal.Decimal
+	id          string
+	side        Side
+	orderType   OrderType
+	timeInForce TimeInForce
+	quantity    decimal.Decimal
+	price       decimal.Decimal
+	stopPrice   decimal.Decimal
+	elem        *list.Element // position in the price level queue
 }
 
-func NewOrder(orderID string, side Side, quantity, price decimal.Decimal) *Order {
+// NewOrder creates an order, the price of MARKET orders is ignored.
+func NewOrder(orderID string, side Side, orderType OrderType, tif TimeInForce, quantity, price decimal.Decimal) *Order {
 	return &Order{
-		id:       orderID,
-		side:     side,
-		quantity: quantity,
-		price:    price,
+		id:          orderID,
+		side:        side,
+		orderType:   orderType,
+		timeInForce: tif,
+		quantity:    quantity,
+		price:       price,
+	}
+}
+
+// NewStopOrder creates a STOP order that is executed as MARKET order once the stop price is reached.
+func NewStopOrder(orderID string, side Side, quantity, stopPrice decimal.Decimal) *Order {
+	return &Order{
+		id:          orderID,
+		side:        side,
+		orderType:   STOP,
+		timeInForce: IOC,
+		quantity:    quantity,
+		stopPrice:   stopPrice,
+	}
+}
+
+// NewStopLimitOrder creates a STOP_LIMIT order that is executed as LIMIT order with the given price and time in
+// force once the stop price is reached.
+func NewStopLimitOrder(orderID string, side Side, tif TimeInForce, quantity, stopPrice, price decimal.Decimal) *Order {
+	return &Order{
+		id:          orderID,
+		side:        side,
+		orderType:   STOP_LIMIT,
+		timeInForce: tif,
+		quantity:    quantity,
+		price:       price,
+		stopPrice:   stopPrice,
 	}
 }
 
@@ -30,6 +64,14 @@ func (o *Order) Side() Side {
 	return o.side
 }
 
+func (o *Order) Type() OrderType {
+	return o.orderType
+}
+
+func (o *Order) TimeInForce() TimeInForce {
+	return o.timeInForce
+}
+
 func (o *Order) Quantity() decimal.Decimal {
 	return o.quantity
 }
@@ -38,6 +80,52 @@ func (o *Order) Price() decimal.Decimal {
 	return o.price
 }
 
+// StopPrice returns the trigger price of STOP and STOP_LIMIT orders.
+func (o *Order) StopPrice() decimal.Decimal {
+	return o.stopPrice
+}
+
+func (o *Order) isStop() bool {
+	return o.orderType == STOP || o.orderType == STOP_LIMIT
+}
+
+// activate returns the order that gets processed once the stop price of a stop order is reached.
+func (o *Order) activate() *Order {
+	if o.orderType == STOP {
+		return NewOrder(o.id, o.side, MARKET, o.timeInForce, o.quantity, decimal.Zero)
+	}
+	return NewOrder(o.id, o.side, LIMIT, o.timeInForce, o.quantity, o.price)
+}
+
+// triggered returns true if a stop order is activated by the given market price. Buy stops trigger at or above,
+// sell stops at or below their stop price.
+func (o *Order) triggered(price decimal.Decimal) bool {
+	if o.side == BUY {
+		return price.GreaterThanOrEqual(o.stopPrice)
+	}
+	return price.LessThanOrEqual(o.stopPrice)
+}
+
+// rests returns true if the remaining quantity of the order is added to the book after matching.
+func (o *Order) rests() bool {
+	return o.orderType == LIMIT && (o.timeInForce == GTC || o.timeInForce == POST_ONLY)
+}
+
+// crosses returns true if the order can be executed against a resting order at the given price.
+func (o *Order) crosses(price decimal.Decimal) bool {
+	if o.orderType == MARKET {
+		return true
+	}
+	if o.side == BUY {
+		return o.price.GreaterThanOrEqual(price)
+	}
+	return o.price.LessThanOrEqual(price)
+}
+
 func (o *Order) String() string {
-	return fmt.Sprintf("ID: %s\nSIDE: %s\nQUANTITY: %s\nPRICE: %s\n", o.id, o.side, o.quantity, o.price)
+	s := fmt.Sprintf("ID: %s\nSIDE: %s\nTYPE: %s\nTIME IN FORCE: %s\nQUANTITY: %s\nPRICE: %s\n", o.id, o.side, o.orderType, o.timeInForce, o.quantity, o.price)
+	if o.isStop() {
+		s += fmt.Sprintf("STOP PRICE: %s\n", o.stopPrice)
+	}
+	return s
 }
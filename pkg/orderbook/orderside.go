@@ -7,7 +7,7 @@ import (
 )
 
 type OrderSide struct {
-	prices    map[string]*Order
+	prices    map[string]*PriceLevel
 	priceTree *rbtx.RedBlackTreeExtended
 	numOrders int
 	depth     int
@@ -22,29 +22,46 @@ func NewOrderSide() *OrderSide {
 		priceTree: &rbtx.RedBlackTreeExtended{
 			Tree: rbt.NewWith(comparator),
 		},
-		prices: map[string]*Order{},
+		prices: map[string]*PriceLevel{},
 	}
 }
 
+// Append adds the order to the end of the queue of its price level and creates the level if it does not exist yet.
 func (os *OrderSide) Append(o *Order) *Order {
-	price := o.Price()
+	return os.appendAt(o.Price(), o)
+}
+
+// Remove removes the order from its price level and deletes the level once it is empty.
+func (os *OrderSide) Remove(o *Order) *Order {
+	return os.removeAt(o.Price(), o)
+}
+
+// appendAt adds the order to the level at the given price, which is not necessarily the order's limit price,
+// e.g. stop orders are kept by their stop price.
+func (os *OrderSide) appendAt(price decimal.Decimal, o *Order) *Order {
 	strPrice := price.String()
 
-	_, ok := os.prices[strPrice]
+	level, ok := os.prices[strPrice]
 	if !ok {
-		os.prices[strPrice] = o
-		os.priceTree.Put(price, o)
+		level = NewPriceLevel(price)
+		os.prices[strPrice] = level
+		os.priceTree.Put(price, level)
 		os.depth++
 	}
 	os.numOrders++
-	return o
+	return level.Append(o)
 }
 
-func (os *OrderSide) Remove(o *Order) *Order {
-	price := o.Price()
+func (os *OrderSide) removeAt(price decimal.Decimal, o *Order) *Order {
 	strPrice := price.String()
 
-	if _, ok := os.prices[strPrice]; ok {
+	level, ok := os.prices[strPrice]
+	if !ok || o.elem == nil {
+		// the order is not queued on this side
+		return o
+	}
+	level.Remove(o)
+	if level.Len() == 0 {
 		delete(os.prices, strPrice)
 		os.priceTree.Remove(price)
 		os.depth--
@@ -53,20 +70,76 @@ func (os *OrderSide) Remove(o *Order) *Order {
 	return o
 }
 
-func (os *OrderSide) MaxPriceOrder() *Order {
+func (os *OrderSide) Len() int {
+	return os.numOrders
+}
+
+func (os *OrderSide) Depth() int {
+	return os.depth
+}
+
+func (os *OrderSide) Level(price decimal.Decimal) *PriceLevel {
+	return os.prices[price.String()]
+}
+
+func (os *OrderSide) MaxPriceLevel() *PriceLevel {
 	if os.depth > 0 {
 		if value, found := os.priceTree.GetMax(); found {
-			return value.(*Order)
+			return value.(*PriceLevel)
 		}
 	}
 	return nil
 }
 
-func (os *OrderSide) MinPriceOrder() *Order {
+func (os *OrderSide) MinPriceLevel() *PriceLevel {
 	if os.depth > 0 {
 		if value, found := os.priceTree.GetMin(); found {
-			return value.(*Order)
+			return value.(*PriceLevel)
 		}
 	}
 	return nil
 }
+
+// MaxPriceOrder returns the order with time priority at the highest price level.
+func (os *OrderSide) MaxPriceOrder() *Order {
+	if level := os.MaxPriceLevel(); level != nil {
+		return level.Head()
+	}
+	return nil
+}
+
+// MinPriceOrder returns the order with time priority at the lowest price level.
+func (os *OrderSide) MinPriceOrder() *Order {
+	if level := os.MinPriceLevel(); level != nil {
+		return level.Head()
+	}
+	return nil
+}
+
+// Ascending returns up to n price levels starting at the lowest price, all levels if n <= 0.
+func (os *OrderSide) Ascending(n int) []*PriceLevel {
+	levels := make([]*PriceLevel, 0, os.limit(n))
+	it := os.priceTree.Iterator()
+	for it.Next() && len(levels) < cap(levels) {
+		levels = append(levels, it.Value().(*PriceLevel))
+	}
+	return levels
+}
+
+// Descending returns up to n price levels starting at the highest price, all levels if n <= 0.
+func (os *OrderSide) Descending(n int) []*PriceLevel {
+	levels := make([]*PriceLevel, 0, os.limit(n))
+	it := os.priceTree.Iterator()
+	it.End()
+	for it.Prev() && len(levels) < cap(levels) {
+		levels = append(levels, it.Value().(*PriceLevel))
+	}
+	return levels
+}
+
+func (os *OrderSide) limit(n int) int {
+	if n <= 0 || n > os.depth {
+		return os.depth
+	}
+	return n
+}
@@ -0,0 +1,52 @@
+package orderbook
+
+type OrderType int
+
+const (
+	// LIMIT orders are executed at their price or better.
+	LIMIT OrderType = iota
+	// MARKET orders sweep the opposite side of the book regardless of the price, they never rest in the book.
+	MARKET
+	// STOP orders become MARKET orders once their stop price is reached, they are kept in a TriggerBook until then.
+	STOP
+	// STOP_LIMIT orders become LIMIT orders once their stop price is reached, they are kept in a TriggerBook until then.
+	STOP_LIMIT
+)
+
+func (t OrderType) String() string {
+	switch t {
+	case MARKET:
+		return "market"
+	case STOP:
+		return "stop"
+	case STOP_LIMIT:
+		return "stop-limit"
+	}
+	return "limit"
+}
+
+// TimeInForce defines how long an order remains active.
+type TimeInForce int
+
+const (
+	// GTC orders rest in the book until they are filled or cancelled.
+	GTC TimeInForce = iota
+	// IOC orders are filled as much as possible, the remainder is cancelled.
+	IOC
+	// FOK orders are either filled completely or rejected.
+	FOK
+	// POST_ONLY orders are rejected if they would cross the book instead of being matched.
+	POST_ONLY
+)
+
+func (tif TimeInForce) String() string {
+	switch tif {
+	case IOC:
+		return "ioc"
+	case FOK:
+		return "fok"
+	case POST_ONLY:
+		return "post-only"
+	}
+	return "gtc"
+}
@@ -0,0 +1,74 @@
+package orderbook
+
+import (
+	"container/list"
+
+	"github.com/shopspring/decimal"
+)
+
+// PriceLevel holds all orders resting at the same price in FIFO order and keeps track of their summed volume.
+type PriceLevel struct {
+	price  decimal.Decimal
+	volume decimal.Decimal
+	orders *list.List
+}
+
+func NewPriceLevel(price decimal.Decimal) *PriceLevel {
+	return &PriceLevel{
+		price:  price,
+		volume: decimal.Zero,
+		orders: list.New(),
+	}
+}
+
+func (pl *PriceLevel) Price() decimal.Decimal {
+	return pl.price
+}
+
+func (pl *PriceLevel) Volume() decimal.Decimal {
+	return pl.volume
+}
+
+func (pl *PriceLevel) Len() int {
+	return pl.orders.Len()
+}
+
+// Head returns the oldest order of the level, it has time priority.
+func (pl *PriceLevel) Head() *Order {
+	e := pl.orders.Front()
+	if e == nil {
+		return nil
+	}
+	return e.Value.(*Order)
+}
+
+// Orders returns the orders of the level in time priority.
+func (pl *PriceLevel) Orders() []*Order {
+	orders := make([]*Order, 0, pl.orders.Len())
+	for e := pl.orders.Front(); e != nil; e = e.Next() {
+		orders = append(orders, e.Value.(*Order))
+	}
+	return orders
+}
+
+func (pl *PriceLevel) Append(o *Order) *Order {
+	o.elem = pl.orders.PushBack(o)
+	pl.volume = pl.volume.Add(o.Quantity())
+	return o
+}
+
+func (pl *PriceLevel) Remove(o *Order) *Order {
+	if o.elem == nil {
+		return o
+	}
+	pl.orders.Remove(o.elem)
+	o.elem = nil
+	pl.volume = pl.volume.Sub(o.Quantity())
+	return o
+}
+
+// Reduce reduces the quantity of a resting order of the level, it keeps its time priority.
+func (pl *PriceLevel) Reduce(o *Order, quantity decimal.Decimal) {
+	o.quantity = o.quantity.Sub(quantity)
+	pl.volume = pl.volume.Sub(quantity)
+}
@@ -0,0 +1,80 @@
+package orderbook
+
+import (
+	"fmt"
+)
+
+// GapError is returned if updates are missing between the last applied sequence number and an update.
+type GapError struct {
+	// Expected is the sequence number that directly follows the last applied one.
+	Expected uint64
+	// Received is the first sequence number of the update.
+	Received uint64
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("%v: expected %d but received %d", ErrSequenceGap, e.Expected, e.Received)
+}
+
+func (e *GapError) Is(target error) bool {
+	return target == ErrSequenceGap
+}
+
+// Sequence returns the sequence number of the last applied update, zero if it is unknown.
+func (ob *OrderBook) Sequence() uint64 {
+	return ob.sequence
+}
+
+// SetSequence sets the sequence number the book state corresponds to, e.g. the one of a snapshot.
+// The sequence number is not changed if it cannot be journaled.
+func (ob *OrderBook) SetSequence(seq uint64) {
+	_ = ob.setSequence(seq)
+}
+
+func (ob *OrderBook) setSequence(seq uint64) error {
+	if seq == ob.sequence {
+		return nil
+	}
+	if err := ob.log(JournalRecord{Op: JournalSequence, Sequence: seq}); err != nil {
+		return err
+	}
+	ob.sequence = seq
+	return nil
+}
+
+// AdvanceSequence checks that an update covering the sequence numbers first to last directly follows the last
+// applied sequence number before the update gets applied. Feeds with a single sequence number per update pass
+// zero as first. Several updates of the same message share the sequence number, so an update with the last applied
+// sequence number is accepted. Updates without a sequence number and the first update of a book without a known
+// sequence number are always accepted.
+//
+// ErrStaleSequence is returned for updates that are older than the last applied one, they must not be applied.
+// An error of the journal is returned if the new sequence number cannot be journaled.
+// A *GapError is returned and a SequenceGap event is emitted if updates are missing, the book needs to be
+// resynchronized from a snapshot.
+func (ob *OrderBook) AdvanceSequence(first, last uint64) error {
+	if first == 0 {
+		first = last
+	}
+	if last == 0 || ob.sequence == 0 {
+		return ob.setSequence(last)
+	}
+	if last < ob.sequence {
+		return ErrStaleSequence
+	}
+	if last == ob.sequence {
+		return nil
+	}
+	if first > ob.sequence+1 {
+		err := &GapError{
+			Expected: ob.sequence + 1,
+			Received: first,
+		}
+		ob.emit(SequenceGap{
+			Expected: err.Expected,
+			Received: err.Received,
+		})
+		return err
+	}
+	return ob.setSequence(last)
+}
@@ -1,40 +1,160 @@
 package orderbook
 
 import (
+	"encoding/json"
 	"fmt"
+
+	"github.com/shopspring/decimal"
 )
 
+const relativeSpreadScale = 8
+
 type Spread struct {
-	highestBidPrice  string
-	highestBidAmount string
-	lowestAskPrice   string
-	lowestAskAmount  string
+	highestBidPrice  decimal.Decimal
+	highestBidAmount decimal.Decimal
+	lowestAskPrice   decimal.Decimal
+	lowestAskAmount  decimal.Decimal
+	hasBid           bool
+	hasAsk           bool
+	priceScale       int32
+	quantityScale    int32
+}
+
+func (s *Spread) HasBid() bool {
+	return s.hasBid
+}
+
+func (s *Spread) HasAsk() bool {
+	return s.hasAsk
+}
+
+func (s *Spread) HighestBidPrice() decimal.Decimal {
+	return s.highestBidPrice
+}
+
+func (s *Spread) HighestBidAmount() decimal.Decimal {
+	return s.highestBidAmount
+}
+
+func (s *Spread) LowestAskPrice() decimal.Decimal {
+	return s.lowestAskPrice
+}
+
+func (s *Spread) LowestAskAmount() decimal.Decimal {
+	return s.lowestAskAmount
+}
+
+// MidPrice returns the average of the best bid and ask price, false if one side of the book is empty.
+func (s *Spread) MidPrice() (decimal.Decimal, bool) {
+	if !s.hasBid || !s.hasAsk {
+		return decimal.Zero, false
+	}
+	return s.highestBidPrice.Add(s.lowestAskPrice).Div(decimal.NewFromInt(2)), true
+}
+
+// Absolute returns the difference between the best ask and bid price, false if one side of the book is empty.
+func (s *Spread) Absolute() (decimal.Decimal, bool) {
+	if !s.hasBid || !s.hasAsk {
+		return decimal.Zero, false
+	}
+	return s.lowestAskPrice.Sub(s.highestBidPrice), true
+}
+
+// Relative returns the absolute spread divided by the mid price, false if one side of the book is empty.
+func (s *Spread) Relative() (decimal.Decimal, bool) {
+	mid, ok := s.MidPrice()
+	if !ok || mid.IsZero() {
+		return decimal.Zero, false
+	}
+	abs, _ := s.Absolute()
+	return abs.Div(mid), true
+}
+
+// Equal reports whether both spreads have the same best bid and ask price and amount.
+func (s *Spread) Equal(other *Spread) bool {
+	return s.hasBid == other.hasBid &&
+		s.hasAsk == other.hasAsk &&
+		s.highestBidPrice.Equal(other.highestBidPrice) &&
+		s.highestBidAmount.Equal(other.highestBidAmount) &&
+		s.lowestAskPrice.Equal(other.lowestAskPrice) &&
+		s.lowestAskAmount.Equal(other.lowestAskAmount)
 }
 
+// MarshalJSON encodes the spread as an object, sides without orders are null.
 func (s *Spread) MarshalJSON() ([]byte, error) {
-	type Bid struct {
-		Price  string `json:"highestBidPriceString"`
-		Amount string `json:"highestBidAmountString"`
+	type spread struct {
+		HighestBidPrice  *string `json:"highestBidPrice"`
+		HighestBidAmount *string `json:"highestBidAmount"`
+		LowestAskPrice   *string `json:"lowestAskPrice"`
+		LowestAskAmount  *string `json:"lowestAskAmount"`
+		MidPrice         *string `json:"midPrice"`
+		Spread           *string `json:"spread"`
+		RelativeSpread   *string `json:"relativeSpread"`
+	}
+
+	var v spread
+	if s.hasBid {
+		v.HighestBidPrice = fixed(s.highestBidPrice, s.priceScale)
+		v.HighestBidAmount = fixed(s.highestBidAmount, s.quantityScale)
+	}
+	if s.hasAsk {
+		v.LowestAskPrice = fixed(s.lowestAskPrice, s.priceScale)
+		v.LowestAskAmount = fixed(s.lowestAskAmount, s.quantityScale)
+	}
+	if mid, ok := s.MidPrice(); ok {
+		// the mid price of two prices on tick can be half a tick
+		scale := s.priceScale
+		if scale >= 0 {
+			scale++
+		}
+		v.MidPrice = fixed(mid, scale)
 	}
-	type Ask struct {
-		Price  string `json:"lowestAskPriceString"`
-		Amount string `json:"lowestAskAmountString"`
+	if abs, ok := s.Absolute(); ok {
+		v.Spread = fixed(abs, s.priceScale)
 	}
+	if rel, ok := s.Relative(); ok {
+		v.RelativeSpread = fixed(rel, relativeSpreadScale)
+	}
+	return json.Marshal(v)
+}
 
-	b := Bid{
-		Price:  s.highestBidPrice,
-		Amount: s.highestBidAmount,
+// AppendTuple appends the spread in the legacy `{{"bid price", "bid amount"}, {"ask price", "ask amount"}}` format
+// to dst, sides without orders are zero. Note, it is not valid JSON.
+func (s *Spread) AppendTuple(dst []byte) []byte {
+	bidPrice, bidAmount := "0", "0"
+	if s.hasBid {
+		bidPrice = tuple(s.highestBidPrice, s.priceScale)
+		bidAmount = tuple(s.highestBidAmount, s.quantityScale)
 	}
-	a := Ask{
-		Price:  s.lowestAskPrice,
-		Amount: s.lowestAskAmount,
+	askPrice, askAmount := "0", "0"
+	if s.hasAsk {
+		askPrice = tuple(s.lowestAskPrice, s.priceScale)
+		askAmount = tuple(s.lowestAskAmount, s.quantityScale)
 	}
 
-	return []byte(fmt.Sprintf(
+	return fmt.Appendf(dst,
 		`{{"%s", "%s"}, {"%s", "%s"}}`,
-		b.Price,
-		b.Amount,
-		a.Price,
-		a.Amount,
-	)), nil
+		bidPrice,
+		bidAmount,
+		askPrice,
+		askAmount,
+	)
+}
+
+// String returns the spread in the legacy tuple format, see AppendTuple.
+func (s *Spread) String() string {
+	return string(s.AppendTuple(nil))
+}
+
+// tuple formats a value of the legacy format, it has at least one decimal place.
+func tuple(d decimal.Decimal, scale int32) string {
+	if scale < 0 {
+		scale = max(1, -d.Exponent())
+	}
+	return d.StringFixed(scale)
+}
+
+func fixed(d decimal.Decimal, scale int32) *string {
+	s := format(d, scale)
+	return &s
 }
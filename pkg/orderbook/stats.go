@@ -0,0 +1,62 @@
+package orderbook
+
+import (
+	"encoding/json"
+
+	"github.com/shopspring/decimal"
+)
+
+// Stats summarizes the resting orders of a book.
+type Stats struct {
+	Sequence   uint64
+	Orders     int
+	BidLevels  int
+	AskLevels  int
+	BidVolume  decimal.Decimal
+	AskVolume  decimal.Decimal
+	instrument *Instrument
+}
+
+// Stats counts the orders and levels and sums the volume of each side.
+func (ob *OrderBook) Stats() *Stats {
+	return &Stats{
+		Sequence:   ob.sequence,
+		Orders:     len(ob.orders),
+		BidLevels:  ob.bids.Depth(),
+		AskLevels:  ob.asks.Depth(),
+		BidVolume:  volume(ob.bids.Descending(0)),
+		AskVolume:  volume(ob.asks.Ascending(0)),
+		instrument: ob.instrument,
+	}
+}
+
+func volume(levels []*PriceLevel) decimal.Decimal {
+	v := decimal.Zero
+	for _, l := range levels {
+		v = v.Add(l.Volume())
+	}
+	return v
+}
+
+// MarshalJSON formats the volumes according to the instrument of the book.
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	instrument := s.instrument
+	if instrument == nil {
+		instrument = DefaultInstrument()
+	}
+	return json.Marshal(struct {
+		Sequence  uint64 `json:"sequence"`
+		Orders    int    `json:"orders"`
+		BidLevels int    `json:"bidLevels"`
+		AskLevels int    `json:"askLevels"`
+		BidVolume string `json:"bidVolume"`
+		AskVolume string `json:"askVolume"`
+	}{
+		Sequence:  s.Sequence,
+		Orders:    s.Orders,
+		BidLevels: s.BidLevels,
+		AskLevels: s.AskLevels,
+		BidVolume: instrument.FormatQuantity(s.BidVolume),
+		AskVolume: instrument.FormatQuantity(s.AskVolume),
+	})
+}
@@ -0,0 +1,20 @@
+package orderbook
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Trade is the execution of an incoming (taker) order against a resting (maker) order at the maker's price.
+type Trade struct {
+	MakerOrderID string
+	TakerOrderID string
+	TakerSide    Side
+	Price        decimal.Decimal
+	Quantity     decimal.Decimal
+}
+
+func (t Trade) String() string {
+	return fmt.Sprintf("MAKER: %s\nTAKER: %s\nSIDE: %s\nQUANTITY: %s\nPRICE: %s\n", t.MakerOrderID, t.TakerOrderID, t.TakerSide, t.Quantity, t.Price)
+}
@@ -0,0 +1,193 @@
+package orderbook
+
+import (
+	rbt "github.com/emirpasic/gods/trees/redblacktree"
+	"github.com/shopspring/decimal"
+)
+
+// Activation is emitted when a stop order is triggered and processed by the order book.
+type Activation struct {
+	// Order is the stop order that got triggered.
+	Order *Order
+	// TriggerPrice is the market price that reached the stop price.
+	TriggerPrice decimal.Decimal
+	// Trades of the activated order.
+	Trades []Trade
+	// Err is set if the order book rejected the activated order.
+	Err error
+}
+
+// TriggerBook holds STOP and STOP_LIMIT orders keyed by their stop price until the last trade or the best
+// bid/ask of the order book reaches the stop price. Buy stops are triggered by a last trade or best ask at or
+// above, sell stops by a last trade or best bid at or below the stop price. A stop order is only triggered by
+// trades executed after it was added, the last trade is forgotten when the order book is cleared.
+type TriggerBook struct {
+	book      *OrderBook
+	stops     map[string]*Order
+	added     map[string]uint64 // trades executed by the order book before a stop order was added
+	buyStops  *OrderSide
+	sellStops *OrderSide
+}
+
+func NewTriggerBook(ob *OrderBook) *TriggerBook {
+	return &TriggerBook{
+		book:      ob,
+		stops:     make(map[string]*Order),
+		added:     make(map[string]uint64),
+		buyStops:  NewOrderSide(),
+		sellStops: NewOrderSide(),
+	}
+}
+
+func (tb *TriggerBook) Book() *OrderBook {
+	return tb.book
+}
+
+func (tb *TriggerBook) Len() int {
+	return len(tb.stops)
+}
+
+// AddOrder adds a stop order, it is not checked against the current prices before the next call to Trigger.
+func (tb *TriggerBook) AddOrder(o *Order) error {
+	if !o.isStop() {
+		return ErrNotStopOrder
+	}
+	if _, ok := tb.stops[o.ID()]; ok {
+		return ErrOrderExists
+	}
+	if _, ok := tb.book.orders[o.ID()]; ok {
+		return ErrOrderExists
+	}
+	if o.Quantity().Sign() <= 0 {
+		return ErrInvalidQuantity
+	}
+	if err := tb.book.instrument.ValidateQuantity(o.Quantity()); err != nil {
+		return err
+	}
+	if o.StopPrice().Sign() <= 0 {
+		return ErrInvalidStop
+	}
+	if err := tb.book.instrument.ValidatePrice(o.StopPrice()); err != nil {
+		return err
+	}
+	if o.Type() == STOP_LIMIT {
+		if o.Price().Sign() <= 0 {
+			return ErrInvalidPrice
+		}
+		if err := tb.book.instrument.ValidatePrice(o.Price()); err != nil {
+			return err
+		}
+	}
+
+	tb.stops[o.ID()] = o
+	tb.added[o.ID()] = tb.book.trades
+	tb.side(o).appendAt(o.StopPrice(), o)
+	return nil
+}
+
+func (tb *TriggerBook) CancelOrder(orderID string) *Order {
+	o, ok := tb.stops[orderID]
+	if !ok {
+		return nil
+	}
+	delete(tb.stops, orderID)
+	delete(tb.added, orderID)
+	return tb.side(o).removeAt(o.StopPrice(), o)
+}
+
+// ProcessOrder adds stop orders to the trigger book and all other orders to the order book.
+// Stop orders triggered by the resulting trades or changes of the best bid/ask are activated.
+func (tb *TriggerBook) ProcessOrder(o *Order) ([]Trade, []Activation, error) {
+	if o.isStop() {
+		if err := tb.AddOrder(o); err != nil {
+			return nil, nil, err
+		}
+		return nil, tb.Trigger(), nil
+	}
+
+	trades, err := tb.book.ProcessOrder(o)
+	if err != nil {
+		return nil, nil, err
+	}
+	return trades, tb.Trigger(), nil
+}
+
+// Trigger activates all stop orders whose stop price has been reached. Activated orders are processed one at a
+// time in stop price and time priority since their trades can trigger further stop orders.
+func (tb *TriggerBook) Trigger() []Activation {
+	var activations []Activation
+	for {
+		o, price, ok := tb.next()
+		if !ok {
+			return activations
+		}
+		tb.CancelOrder(o.ID())
+
+		trades, err := tb.book.ProcessOrder(o.activate())
+		activations = append(activations, Activation{
+			Order:        o,
+			TriggerPrice: price,
+			Trades:       trades,
+			Err:          err,
+		})
+	}
+}
+
+// next returns the next stop order that is triggered by the current market prices.
+func (tb *TriggerBook) next() (*Order, decimal.Decimal, bool) {
+	lastTrade, hasTrade := tb.book.LastTradePrice()
+
+	if hasTrade {
+		if o := tb.tradeTriggered(tb.buyStops.priceTree.Iterator(), true, lastTrade); o != nil {
+			return o, lastTrade, true
+		}
+	}
+	if level := tb.buyStops.MinPriceLevel(); level != nil {
+		o := level.Head()
+		if ask := tb.book.asks.MinPriceLevel(); ask != nil && o.triggered(ask.Price()) {
+			return o, ask.Price(), true
+		}
+	}
+
+	if hasTrade {
+		if o := tb.tradeTriggered(tb.sellStops.priceTree.Iterator(), false, lastTrade); o != nil {
+			return o, lastTrade, true
+		}
+	}
+	if level := tb.sellStops.MaxPriceLevel(); level != nil {
+		o := level.Head()
+		if bid := tb.book.bids.MaxPriceLevel(); bid != nil && o.triggered(bid.Price()) {
+			return o, bid.Price(), true
+		}
+	}
+
+	return nil, decimal.Zero, false
+}
+
+// tradeTriggered returns the first stop order in stop price and time priority that is triggered by the last
+// trade and was added before it. Buy stops are visited by ascending, sell stops by descending stop price.
+func (tb *TriggerBook) tradeTriggered(it rbt.Iterator, ascending bool, price decimal.Decimal) *Order {
+	advance := it.Next
+	if !ascending {
+		it.End()
+		advance = it.Prev
+	}
+	for advance() {
+		for _, o := range it.Value().(*PriceLevel).Orders() {
+			if !o.triggered(price) {
+				return nil
+			}
+			if tb.added[o.ID()] < tb.book.trades {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+func (tb *TriggerBook) side(o *Order) *OrderSide {
+	if o.Side() == BUY {
+		return tb.buyStops
+	}
+	return tb.sellStops
+}
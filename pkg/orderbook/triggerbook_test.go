@@ -0,0 +1,106 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerBook(t *testing.T) {
+	d := decimal.RequireFromString
+
+	ob := NewOrderBook(WithMatching())
+	tb := NewTriggerBook(ob)
+	assert.NoError(t, ob.AddOrder("a1", SELL, d("1"), d("101")))
+	assert.NoError(t, ob.AddOrder("a2", SELL, d("1"), d("102")))
+	assert.NoError(t, ob.AddOrder("a3", SELL, d("2"), d("105")))
+	assert.NoError(t, ob.AddOrder("b1", BUY, d("1"), d("99")))
+	assert.NoError(t, ob.AddOrder("b2", BUY, d("1"), d("97")))
+
+	assert.ErrorIs(t, tb.AddOrder(NewOrder("x", BUY, LIMIT, GTC, d("1"), d("100"))), ErrNotStopOrder)
+	assert.ErrorIs(t, tb.AddOrder(NewStopOrder("a1", BUY, d("1"), d("100"))), ErrOrderExists)
+	_, err := ob.ProcessOrder(NewStopOrder("s", BUY, d("1"), d("100")))
+	assert.ErrorIs(t, err, ErrStopOrder)
+
+	assert.NoError(t, tb.AddOrder(NewStopOrder("s1", BUY, d("1"), d("102"))))
+	assert.NoError(t, tb.AddOrder(NewStopLimitOrder("s2", BUY, GTC, d("3"), d("104"), d("105"))))
+	assert.NoError(t, tb.AddOrder(NewStopOrder("s3", SELL, d("1"), d("98"))))
+	assert.Empty(t, tb.Trigger())
+	assert.Equal(t, 3, tb.Len())
+
+	// lifting the ask at 101 moves the best ask to 102, which triggers the buy stop at 102,
+	// its fill at 102 moves the best ask to 105 and triggers the stop limit at 104 with a limit of 105
+	trades, activations, err := tb.ProcessOrder(NewOrder("t1", BUY, LIMIT, IOC, d("1"), d("101")))
+	assert.NoError(t, err)
+	assert.Len(t, trades, 1)
+	assert.Len(t, activations, 2)
+
+	assert.Equal(t, "s1", activations[0].Order.ID())
+	assert.Equal(t, "102", activations[0].TriggerPrice.String())
+	assert.NoError(t, activations[0].Err)
+	assert.Equal(t, []Trade{
+		{MakerOrderID: "a2", TakerOrderID: "s1", TakerSide: BUY, Price: d("102"), Quantity: d("1")},
+	}, activations[0].Trades)
+
+	assert.Equal(t, "s2", activations[1].Order.ID())
+	assert.NoError(t, activations[1].Err)
+	assert.Equal(t, []Trade{
+		{MakerOrderID: "a3", TakerOrderID: "s2", TakerSide: BUY, Price: d("105"), Quantity: d("2")},
+	}, activations[1].Trades)
+	assert.Equal(t, "105", ob.bids.MaxPriceLevel().Price().String())
+	assert.Equal(t, "1", ob.bids.MaxPriceLevel().Volume().String())
+
+	// the sell stop is cancelled before it triggers
+	assert.NotNil(t, tb.CancelOrder("s3"))
+	assert.Equal(t, 0, tb.Len())
+	_, activations, err = tb.ProcessOrder(NewOrder("t2", SELL, MARKET, IOC, d("3"), decimal.Zero))
+	assert.NoError(t, err)
+	assert.Empty(t, activations)
+
+	assert.Nil(t, ob.bids.MaxPriceLevel())
+
+	// a sell stop is triggered by the best bid
+	assert.NoError(t, ob.AddOrder("b3", BUY, d("1"), d("96")))
+	assert.NoError(t, ob.AddOrder("b4", BUY, d("1"), d("95")))
+	assert.NoError(t, tb.AddOrder(NewStopOrder("s4", SELL, d("1"), d("95.5"))))
+	assert.Empty(t, tb.Trigger())
+	ob.CancelOrder("b3")
+	activations = tb.Trigger()
+	assert.Len(t, activations, 1)
+	assert.Equal(t, "95", activations[0].TriggerPrice.String())
+	assert.Len(t, activations[0].Trades, 1)
+	assert.Nil(t, ob.bids.MaxPriceLevel())
+}
+
+func TestTriggerBookPastTrades(t *testing.T) {
+	d := decimal.RequireFromString
+
+	ob := NewOrderBook(WithMatching())
+	tb := NewTriggerBook(ob)
+	assert.NoError(t, ob.AddOrder("a1", SELL, d("1"), d("105")))
+	_, err := ob.ProcessOrder(NewOrder("t1", BUY, LIMIT, IOC, d("1"), d("105")))
+	assert.NoError(t, err)
+	assert.NoError(t, ob.AddOrder("a2", SELL, d("1"), d("103")))
+
+	// a stop is not triggered by a trade executed before it was added
+	assert.NoError(t, tb.AddOrder(NewStopOrder("s1", BUY, d("1"), d("104"))))
+	assert.Empty(t, tb.Trigger())
+
+	// but by the next one
+	assert.NoError(t, ob.AddOrder("a3", SELL, d("1"), d("104")))
+	trades, activations, err := tb.ProcessOrder(NewOrder("t2", BUY, LIMIT, IOC, d("2"), d("104")))
+	assert.NoError(t, err)
+	assert.Len(t, trades, 2)
+	assert.Len(t, activations, 1)
+	assert.Equal(t, "s1", activations[0].Order.ID())
+	assert.Equal(t, "104", activations[0].TriggerPrice.String())
+
+	// clearing the book forgets the last trade
+	ob.Clear()
+	_, ok := ob.LastTradePrice()
+	assert.False(t, ok)
+	assert.NoError(t, tb.AddOrder(NewStopOrder("s2", BUY, d("1"), d("100"))))
+	assert.Empty(t, tb.Trigger())
+	assert.Equal(t, 1, tb.Len())
+}
@@ -0,0 +1,18 @@
+package output
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// WithDepth adds the best n bid and ask levels to the records of the json and csv formats.
+func WithDepth(n int) Option {
+	return func(w *Writer) {
+		w.depth = n
+	}
+}
+
+// WithChangesOnly writes a record only if the best bid or ask of the book changed.
+func WithChangesOnly() Option {
+	return func(w *Writer) {
+		w.changesOnly = true
+	}
+}
@@ -0,0 +1,171 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+)
+
+var ErrUnknownFormat = errors.New("unknown output format")
+
+// Format is the encoding of the records written by a Writer.
+type Format int
+
+const (
+	// FormatTuple writes the spread in the legacy `{{"bid price", "bid amount"}, {"ask price", "ask amount"}}`
+	// format, one line per record. It holds neither the symbol nor the depth.
+	FormatTuple Format = iota
+	// FormatJSON writes one JSON object per line.
+	FormatJSON
+	// FormatCSV writes a header and one row per record.
+	FormatCSV
+)
+
+// ParseFormat returns the format by its name, tuple, json or csv.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "tuple":
+		return FormatTuple, nil
+	case "json":
+		return FormatJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatCSV:
+		return "csv"
+	}
+	return "tuple"
+}
+
+// Writer writes the state of order books, e.g. after every update. It is safe for concurrent use, so it can be
+// shared by the books of a feed.BookManager.
+type Writer struct {
+	format      Format
+	depth       int
+	changesOnly bool
+
+	mu     sync.Mutex
+	w      io.Writer
+	csv    *csv.Writer
+	header bool
+	last   map[string]*orderbook.Spread // last written spread per symbol
+}
+
+// NewWriter creates a writer that writes the records to w in the given format.
+func NewWriter(w io.Writer, format Format, opts ...Option) *Writer {
+	wr := &Writer{
+		format: format,
+		w:      w,
+		last:   make(map[string]*orderbook.Spread),
+	}
+	if format == FormatCSV {
+		wr.csv = csv.NewWriter(w)
+	}
+	for _, opt := range opts {
+		opt(wr)
+	}
+	return wr
+}
+
+// Write writes a record of the latest snapshot of the book. With WithChangesOnly the record is skipped if the best
+// bid and ask did not change since the last record of the symbol.
+func (w *Writer) Write(symbol string, offset int64, ob *orderbook.ConcurrentOrderBook) error {
+	s := ob.Snapshot()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.changesOnly {
+		if last, ok := w.last[symbol]; ok && last.Equal(s.Spread) {
+			return nil
+		}
+		w.last[symbol] = s.Spread
+	}
+
+	depth := s.Depth
+	if w.depth > 0 {
+		depth = ob.Depth(w.depth)
+	}
+	switch w.format {
+	case FormatJSON:
+		return w.writeJSON(symbol, offset, s, depth)
+	case FormatCSV:
+		return w.writeCSV(symbol, offset, s, depth, ob.Instrument())
+	}
+	_, err := w.w.Write(append(s.Spread.AppendTuple(nil), '\n'))
+	return err
+}
+
+type record struct {
+	Symbol   string            `json:"symbol"`
+	Sequence uint64            `json:"sequence"`
+	Offset   int64             `json:"offset"`
+	Spread   *orderbook.Spread `json:"spread"`
+	Depth    *orderbook.Depth  `json:"depth,omitempty"`
+}
+
+func (w *Writer) writeJSON(symbol string, offset int64, s *orderbook.Snapshot, depth *orderbook.Depth) error {
+	r := record{
+		Symbol:   symbol,
+		Sequence: s.Sequence,
+		Offset:   offset,
+		Spread:   s.Spread,
+	}
+	if w.depth > 0 {
+		r.Depth = depth
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w.w, string(b))
+	return err
+}
+
+// writeCSV writes the best bid and ask followed by the price and quantity of the levels up to the depth of the
+// writer, the columns of missing levels are empty.
+func (w *Writer) writeCSV(symbol string, offset int64, s *orderbook.Snapshot, depth *orderbook.Depth, instrument *orderbook.Instrument) error {
+	if !w.header {
+		header := []string{"symbol", "sequence", "offset", "bid_price", "bid_amount", "ask_price", "ask_amount"}
+		for i := 1; i <= w.depth; i++ {
+			n := strconv.Itoa(i)
+			header = append(header, "bid_price_"+n, "bid_quantity_"+n, "ask_price_"+n, "ask_quantity_"+n)
+		}
+		if err := w.csv.Write(header); err != nil {
+			return err
+		}
+		w.header = true
+	}
+
+	row := []string{symbol, strconv.FormatUint(s.Sequence, 10), strconv.FormatInt(offset, 10)}
+	row = append(row, level(depth.Bids, 0, instrument)...)
+	row = append(row, level(depth.Asks, 0, instrument)...)
+	for i := 0; i < w.depth; i++ {
+		row = append(row, level(depth.Bids, i, instrument)...)
+		row = append(row, level(depth.Asks, i, instrument)...)
+	}
+	if err := w.csv.Write(row); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func level(levels []orderbook.DepthLevel, i int, instrument *orderbook.Instrument) []string {
+	if i >= len(levels) {
+		return []string{"", ""}
+	}
+	return []string{instrument.FormatPrice(levels[i].Price), instrument.FormatQuantity(levels[i].Quantity)}
+}
@@ -0,0 +1,81 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	d := decimal.RequireFromString
+	instrument := orderbook.NewInstrument("BTC-USD", d("0.01"), d("0.001"))
+	ob := orderbook.NewConcurrentOrderBook(orderbook.NewOrderBook(orderbook.WithInstrument(instrument)), 0)
+	// writes a record after every order, the second bid does not change the best bid
+	apply := func(w *Writer) {
+		ob.Clear()
+		assert.NoError(t, ob.AddOrder("b1", orderbook.BUY, d("1"), d("99")))
+		assert.NoError(t, w.Write("BTC-USD", 1, ob))
+		assert.NoError(t, ob.AddOrder("b2", orderbook.BUY, d("2"), d("98.5")))
+		assert.NoError(t, w.Write("BTC-USD", 2, ob))
+		assert.NoError(t, ob.AddOrder("a1", orderbook.SELL, d("0.5"), d("101")))
+		assert.NoError(t, w.Write("BTC-USD", 3, ob))
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		opts     []Option
+		expected string
+	}{
+		{
+			name:   "tuple",
+			format: "tuple",
+			expected: `{{"99.00", "1.000"}, {"0", "0"}}
+{{"99.00", "1.000"}, {"0", "0"}}
+{{"99.00", "1.000"}, {"101.00", "0.500"}}
+`,
+		},
+		{
+			name:   "tuple changes only",
+			format: "tuple",
+			opts:   []Option{WithChangesOnly()},
+			expected: `{{"99.00", "1.000"}, {"0", "0"}}
+{{"99.00", "1.000"}, {"101.00", "0.500"}}
+`,
+		},
+		{
+			name:   "json",
+			format: "json",
+			opts:   []Option{WithChangesOnly(), WithDepth(1)},
+			expected: `{"symbol":"BTC-USD","sequence":0,"offset":1,"spread":{"highestBidPrice":"99.00","highestBidAmount":"1.000","lowestAskPrice":null,"lowestAskAmount":null,"midPrice":null,"spread":null,"relativeSpread":null},"depth":{"bids":[{"price":"99.00","quantity":"1.000","orders":1}],"asks":[]}}
+{"symbol":"BTC-USD","sequence":0,"offset":3,"spread":{"highestBidPrice":"99.00","highestBidAmount":"1.000","lowestAskPrice":"101.00","lowestAskAmount":"0.500","midPrice":"100.000","spread":"2.00","relativeSpread":"0.02000000"},"depth":{"bids":[{"price":"99.00","quantity":"1.000","orders":1}],"asks":[{"price":"101.00","quantity":"0.500","orders":1}]}}
+`,
+		},
+		{
+			name:   "csv",
+			format: "csv",
+			opts:   []Option{WithDepth(2)},
+			expected: `symbol,sequence,offset,bid_price,bid_amount,ask_price,ask_amount,bid_price_1,bid_quantity_1,ask_price_1,ask_quantity_1,bid_price_2,bid_quantity_2,ask_price_2,ask_quantity_2
+BTC-USD,0,1,99.00,1.000,,,99.00,1.000,,,,,,
+BTC-USD,0,2,99.00,1.000,,,99.00,1.000,,,98.50,2.000,,
+BTC-USD,0,3,99.00,1.000,101.00,0.500,99.00,1.000,101.00,0.500,98.50,2.000,,
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := ParseFormat(tc.format)
+			assert.NoError(t, err)
+			var b bytes.Buffer
+			apply(NewWriter(&b, format, tc.opts...))
+			assert.Equal(t, tc.expected, b.String())
+		})
+	}
+
+	_, err := ParseFormat("xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,84 @@
+package parse
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// BinanceParser parses Binance diff depth stream events and REST depth snapshots.
+// Events of combined streams are unwrapped.
+//
+//	{"lastUpdateId":1027024,"bids":[["4.00000000","431.00000000"]],"asks":[["4.00000200","12.00000000"]]}
+//	{"e":"depthUpdate","E":123456789,"s":"BNBBTC","U":157,"u":160,"b":[["0.0024","10"]],"a":[["0.0026","100"]]}
+type BinanceParser struct {
+	*streamParser
+}
+
+func NewBinanceParser(rc io.ReadCloser, opts ...Option) *BinanceParser {
+	return &BinanceParser{
+		streamParser: newStreamParser(rc, parseBinanceMessage, opts...),
+	}
+}
+
+type binanceMessage struct {
+	// combined stream wrapper
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+	// depth update event
+	Event         string     `json:"e"`
+	EventTime     int64      `json:"E"`
+	Symbol        string     `json:"s"`
+	FirstUpdateID uint64     `json:"U"`
+	FinalUpdateID uint64     `json:"u"`
+	BidChanges    [][]string `json:"b"`
+	AskChanges    [][]string `json:"a"`
+	// depth snapshot
+	LastUpdateID uint64     `json:"lastUpdateId"`
+	Bids         [][]string `json:"bids"`
+	Asks         [][]string `json:"asks"`
+}
+
+func parseBinanceMessage(raw json.RawMessage) ([]Update, error) {
+	var msg binanceMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Stream != "" && len(msg.Data) > 0 {
+		return parseBinanceMessage(msg.Data)
+	}
+
+	bidField, bids, askField, asks := "b", msg.BidChanges, "a", msg.AskChanges
+	first, last := msg.FirstUpdateID, msg.FinalUpdateID
+	var ts time.Time
+	switch {
+	case msg.Event == "depthUpdate":
+		ts = time.UnixMilli(msg.EventTime).UTC()
+	case msg.LastUpdateID > 0:
+		bidField, bids, askField, asks = "bids", msg.Bids, "asks", msg.Asks
+		first, last = 0, msg.LastUpdateID
+	default:
+		// other events and responses to subscriptions
+		return nil, nil
+	}
+
+	b, err := levels(bidField, BUY, bids)
+	if err != nil {
+		return nil, err
+	}
+	a, err := levels(askField, SELL, asks)
+	if err != nil {
+		return nil, err
+	}
+	updates := append(b, a...)
+	if msg.LastUpdateID > 0 {
+		updates = snapshot(updates)
+	}
+	for i := range updates {
+		updates[i].Symbol = msg.Symbol
+		updates[i].FirstSequence = first
+		updates[i].Sequence = last
+		updates[i].Time = optional(ts)
+	}
+	return updates, nil
+}
@@ -0,0 +1,85 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// CoinbaseParser parses messages of the Coinbase level2 channel.
+//
+//	{"type":"snapshot","product_id":"BTC-USD","bids":[["10101.10","0.45054140"]],"asks":[["10102.55","0.57753524"]]}
+//	{"type":"l2update","product_id":"BTC-USD","time":"2019-08-14T20:42:27.265Z","changes":[["buy","10101.80000000","0.162567"]]}
+type CoinbaseParser struct {
+	*streamParser
+}
+
+func NewCoinbaseParser(rc io.ReadCloser, opts ...Option) *CoinbaseParser {
+	return &CoinbaseParser{
+		streamParser: newStreamParser(rc, parseCoinbaseMessage, opts...),
+	}
+}
+
+type coinbaseMessage struct {
+	Type      string     `json:"type"`
+	ProductID string     `json:"product_id"`
+	Time      string     `json:"time"`
+	Sequence  uint64     `json:"sequence"`
+	Bids      [][]string `json:"bids"`
+	Asks      [][]string `json:"asks"`
+	Changes   [][]string `json:"changes"`
+}
+
+func parseCoinbaseMessage(raw json.RawMessage) ([]Update, error) {
+	var msg coinbaseMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+
+	var updates []Update
+	switch msg.Type {
+	case "snapshot":
+		bids, err := levels("bids", BUY, msg.Bids)
+		if err != nil {
+			return nil, err
+		}
+		asks, err := levels("asks", SELL, msg.Asks)
+		if err != nil {
+			return nil, err
+		}
+		updates = snapshot(append(bids, asks...))
+	case "l2update":
+		updates = make([]Update, 0, len(msg.Changes))
+		for _, c := range msg.Changes {
+			if len(c) != 3 {
+				return nil, fieldError("changes", fmt.Errorf("%w: %q", errInvalidLevel, c))
+			}
+			if c[0] != BUY && c[0] != SELL {
+				return nil, fieldError("changes", fmt.Errorf("side not supported: %q", c[0]))
+			}
+			updates = append(updates, Update{
+				Side:     c[0],
+				Price:    c[1],
+				Quantity: c[2],
+			})
+		}
+	default:
+		// subscriptions, heartbeats and other channels
+		return nil, nil
+	}
+
+	var ts time.Time
+	if msg.Time != "" {
+		var err error
+		if ts, err = time.Parse(time.RFC3339Nano, msg.Time); err != nil {
+			return nil, fieldError("time", err)
+		}
+	}
+	for i := range updates {
+		updates[i].Symbol = msg.ProductID
+		updates[i].Sequence = msg.Sequence
+		updates[i].Time = optional(ts)
+	}
+	return updates, nil
+}
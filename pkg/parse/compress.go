@@ -0,0 +1,48 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Decompress returns the decompressed stream of gzip or zstd compressed input, other input is returned as is.
+// The compression is detected by the magic number of the format. Closing the returned reader releases the
+// decompressor, it does not close r.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	rc, _, err := decompress(bufio.NewReader(r))
+	return rc, err
+}
+
+// decompress detects the compression by peeking at the stream, it returns false for uncompressed input.
+func decompress(br *bufio.Reader) (io.ReadCloser, bool, error) {
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, false, fmt.Errorf("error reading gzip header: %w", err)
+		}
+		return zr, true, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		// a single goroutine is enough for decoding a stream, the default starts one per core
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, err
+		}
+		return zr.IOReadCloser(), true, nil
+	}
+	return io.NopCloser(br), false, nil
+}
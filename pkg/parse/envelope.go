@@ -0,0 +1,53 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Recordings of a feed hold one envelope per line with the receive time and the message as it was received:
+//
+//	{"recv":"2022-10-13T14:52:11.354218Z","msg":{"type":"l2update","product_id":"BTC-USD",...}}
+//
+// Messages that are not valid JSON are recorded as string in raw instead of msg. The parsers unwrap envelopes, so
+// a recording is parsed like the feed it was recorded from.
+type envelope struct {
+	Received time.Time       `json:"recv"`
+	Msg      json.RawMessage `json:"msg"`
+	Raw      *string         `json:"raw"`
+}
+
+var envelopePrefix = []byte(`{"recv":`)
+
+// AppendEnvelope appends the envelope of a message received at the given time and a newline to dst.
+func AppendEnvelope(dst []byte, received time.Time, msg []byte) []byte {
+	dst = append(dst, envelopePrefix...)
+	dst = strconv.AppendQuote(dst, received.UTC().Format(time.RFC3339Nano))
+	if json.Valid(msg) {
+		// the message is not re-encoded so that it is replayed byte for byte
+		dst = append(dst, `,"msg":`...)
+		dst = append(dst, msg...)
+	} else {
+		dst = append(dst, `,"raw":`...)
+		b, _ := json.Marshal(string(msg))
+		dst = append(dst, b...)
+	}
+	return append(dst, '}', '\n')
+}
+
+// unwrap returns the message of an envelope and its receive time, other messages are returned as they are.
+func unwrap(raw json.RawMessage) (json.RawMessage, time.Time, error) {
+	if !bytes.HasPrefix(raw, envelopePrefix) {
+		return raw, time.Time{}, nil
+	}
+	var e envelope
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return raw, time.Time{}, err
+	}
+	if e.Raw != nil {
+		return json.RawMessage(*e.Raw), e.Received, nil
+	}
+	return e.Msg, e.Received, nil
+}
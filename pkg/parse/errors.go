@@ -0,0 +1,76 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorPolicy defines how a parser handles messages that cannot be parsed.
+// A malformed line of newline delimited JSON is a malformed message, malformed JSON that breaks the framing of an
+// array of messages always stops the parser.
+type ErrorPolicy int
+
+const (
+	// FailFast stops the parser and sends the ParseError on the error channel.
+	FailFast ErrorPolicy = iota
+	// SkipAndCount drops the message and increments the skipped counter.
+	SkipAndCount
+	// Quarantine writes the raw message to the quarantine writer, drops it and increments the skipped counter.
+	Quarantine
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case SkipAndCount:
+		return "skip"
+	case Quarantine:
+		return "quarantine"
+	}
+	return "fail-fast"
+}
+
+// ParseError describes a message that could not be parsed.
+type ParseError struct {
+	// Offset is the position in the stream after the previous message.
+	Offset int64
+	// Field is the name of the field that could not be parsed, empty if the message itself is malformed.
+	Field string
+	Cause error
+	// Raw holds the message, it is empty if the message could not be read from the stream.
+	Raw json.RawMessage
+}
+
+func (e *ParseError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("parse error at offset %d: %v", e.Offset, e.Cause)
+	}
+	return fmt.Sprintf("parse error at offset %d in field %q: %v", e.Offset, e.Field, e.Cause)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Cause
+}
+
+func fieldError(field string, cause error) *ParseError {
+	return &ParseError{
+		Field: field,
+		Cause: cause,
+	}
+}
+
+// newParseError wraps err in a ParseError for the message at the given offset, keeping the field of
+// ParseErrors returned by message handlers and of JSON type errors.
+func newParseError(offset int64, raw json.RawMessage, err error) *ParseError {
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		perr = &ParseError{Cause: err}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			perr.Field = typeErr.Field
+		}
+	}
+	perr.Offset = offset
+	perr.Raw = raw
+	return perr
+}
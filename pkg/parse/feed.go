@@ -0,0 +1,399 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// FeedParser reads order book messages of an exchange feed from a stream and emits them as updates.
+type FeedParser interface {
+	// Run starts parsing in the background. Updates are sent on the first channel, it is closed when parsing
+	// stops. The error that stopped parsing, e.g. io.EOF, a *ParseError or the error of the context, is sent on
+	// the second one afterwards. All updates of a message are sent before the context is checked again.
+	Run(ctx context.Context) (chan Update, chan error)
+	// Close closes the underlying stream, a pending read fails and parsing stops.
+	Close() error
+}
+
+var (
+	_ FeedParser = (*JSONStreamParser)(nil)
+	_ FeedParser = (*CoinbaseParser)(nil)
+	_ FeedParser = (*BinanceParser)(nil)
+	_ FeedParser = (*KrakenParser)(nil)
+)
+
+// ErrUnknownFormat is returned by NewFeedParser for formats without a parser.
+var ErrUnknownFormat = errors.New("unknown feed format")
+
+// Formats are the names of the feed formats supported by NewFeedParser.
+var Formats = []string{"json", "coinbase", "binance", "kraken"}
+
+// NewFeedParser returns the parser of a feed format by its name: json for JSON arrays of messages like the
+// sample file, coinbase, binance or kraken for newline delimited messages recorded from the exchange's websocket.
+func NewFeedParser(format string, rc io.ReadCloser, opts ...Option) (FeedParser, error) {
+	switch format {
+	case "json":
+		return NewJSONStreamParser(rc, opts...), nil
+	case "coinbase":
+		return NewCoinbaseParser(rc, opts...), nil
+	case "binance":
+		return NewBinanceParser(rc, opts...), nil
+	case "kraken":
+		return NewKrakenParser(rc, opts...), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// messageHandler converts a single feed message into updates. Messages that carry no order book data,
+// e.g. heartbeats or subscription confirmations, result in no updates.
+type messageHandler func(raw json.RawMessage) ([]Update, error)
+
+// streamParser reads a stream of newline delimited JSON messages, e.g. as recorded from a websocket, or
+// concatenated JSON arrays of messages and hands each message to an exchange specific handler. The framing is
+// detected, gzip and zstd compressed streams are decompressed on the fly and recorded messages are unwrapped from
+// their envelopes. A malformed line is a malformed message, the error policy applies and the next line is read.
+type streamParser struct {
+	reader     io.ReadCloser
+	decoder    *json.Decoder // reads array framing
+	lines      *bufio.Reader // reads newline delimited framing
+	read       int64         // bytes read from lines
+	end        int64         // offset after the last message read from lines, relative to base
+	handle     messageHandler
+	array      bool  // messages are elements of a top-level array, detected when parsing starts
+	opened     bool  // the opening bracket of the current array has been read
+	start      int64 // offset to resume the stream at
+	base       int64 // offset of the first byte read by the decoder or lines
+	policy     ErrorPolicy
+	quarantine io.Writer
+	// decompressor reads compressed streams, it is closed when parsing stops
+	decompressor io.Closer
+	skipped      atomic.Int64
+	UpdateCh     chan Update
+	ErrCh        chan error
+}
+
+func newStreamParser(rc io.ReadCloser, handle messageHandler, opts ...Option) *streamParser {
+	p := &streamParser{
+		reader:   rc,
+		handle:   handle,
+		UpdateCh: make(chan Update, 1000),
+		ErrCh:    make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *streamParser) Run(ctx context.Context) (chan Update, chan error) {
+	go func() {
+		err := p.run(ctx)
+		// the update channel is owned by this goroutine, it is closed before the error is sent so that
+		// receivers can drain it
+		close(p.UpdateCh)
+		p.ErrCh <- err
+		close(p.ErrCh)
+	}()
+
+	return p.UpdateCh, p.ErrCh
+}
+
+func (p *streamParser) run(ctx context.Context) error {
+	if p.decoder == nil && p.lines == nil {
+		r, err := p.open()
+		if err != nil {
+			return newParseError(p.start, nil, err)
+		}
+		if p.array {
+			p.decoder = json.NewDecoder(r)
+		} else {
+			p.lines = bufio.NewReader(r)
+		}
+	}
+	if p.decompressor != nil {
+		defer p.decompressor.Close()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		offset := p.offset()
+		raw, err := p.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return err
+			}
+			if raw == nil {
+				// the stream cannot be read any further
+				return newParseError(offset, nil, err)
+			}
+			if err := p.handleError(newParseError(offset, raw, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, received, err := unwrap(raw)
+		var updates []Update
+		if err == nil {
+			updates, err = p.handle(raw)
+		}
+		if err != nil {
+			if err := p.handleError(newParseError(offset, raw, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		end := p.offset()
+		for i, u := range updates {
+			u.Received = optional(received)
+			u.Offset = end
+			u.Last = i == len(updates)-1
+			p.UpdateCh <- u
+		}
+	}
+}
+
+// open returns the stream to decode. Compressed streams are decompressed and the framing is detected before the
+// stream is skipped to the start offset, an offset of an update. For array framing the remainder of the array is
+// turned into an array of its own.
+func (p *streamParser) open() (io.Reader, error) {
+	br := bufio.NewReader(p.reader)
+	rc, compressed, err := decompress(br)
+	if err != nil {
+		return nil, err
+	}
+	p.decompressor = rc
+	if compressed {
+		br = bufio.NewReader(rc)
+	}
+	if p.array, err = isArray(br); err != nil {
+		return nil, err
+	}
+	if p.start <= 0 {
+		return br, nil
+	}
+
+	var r io.Reader = br
+	if s, ok := seeker(p.reader); ok && !compressed {
+		if _, err := s.Seek(p.start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		// the buffered data is discarded
+		r = p.reader
+	} else if _, err := io.CopyN(io.Discard, br, p.start); err != nil {
+		return nil, err
+	}
+	p.base = p.start
+	if !p.array {
+		return r, nil
+	}
+
+	// drop the comma separating the next element from the last processed one
+	br = bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		p.base++
+		if b == ',' {
+			break
+		}
+		if !isSpace(b) {
+			// the end of the array
+			if err := br.UnreadByte(); err != nil {
+				return nil, err
+			}
+			p.base--
+			break
+		}
+	}
+	// account for the opening bracket
+	p.base--
+	return io.MultiReader(strings.NewReader("["), br), nil
+}
+
+// isArray detects the framing of the stream. A top-level array of messages starts with an opening bracket that is
+// followed by a message object or array, the array messages of Kraken start with the channel ID instead.
+func isArray(br *bufio.Reader) (bool, error) {
+	var tokens []byte
+	for n := 1; len(tokens) < 2; n++ {
+		b, err := br.Peek(n)
+		if errors.Is(err, io.EOF) || errors.Is(err, bufio.ErrBufferFull) {
+			// empty or whitespace only, it is decoded as such
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if isSpace(b[n-1]) {
+			continue
+		}
+		tokens = append(tokens, b[n-1])
+		if tokens[0] != '[' {
+			return false, nil
+		}
+	}
+	return tokens[1] == '{' || tokens[1] == '[' || tokens[1] == ']', nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// seeker returns the stream as io.Seeker if it supports seeking, e.g. files but not pipes.
+func seeker(r io.Reader) (io.Seeker, bool) {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return nil, false
+	}
+	if _, err := s.Seek(0, io.SeekCurrent); err != nil {
+		return nil, false
+	}
+	return s, true
+}
+
+// offset returns the offset in the stream after the last message that has been read.
+func (p *streamParser) offset() int64 {
+	if p.lines != nil {
+		return p.base + p.end
+	}
+	return p.base + p.decoder.InputOffset()
+}
+
+// next reads the next message from the stream, it returns io.EOF at the end of the stream or the last array.
+// A malformed line is returned with its error, the stream can be read further.
+func (p *streamParser) next() (json.RawMessage, error) {
+	if p.lines != nil {
+		return p.nextLine()
+	}
+	for {
+		if !p.opened {
+			token, err := p.decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			if delim, ok := token.(json.Delim); !ok || delim != '[' {
+				return nil, fmt.Errorf("expected opening bracket of array but got: %v", token)
+			}
+			p.opened = true
+		}
+		if p.decoder.More() {
+			break
+		}
+		// read the closing bracket, concatenated arrays, e.g. of several files, are read one after the other
+		if _, err := p.decoder.Token(); err != nil {
+			return nil, err
+		}
+		if !p.decoder.More() {
+			return nil, io.EOF
+		}
+		p.opened = false
+	}
+
+	var raw json.RawMessage
+	if err := p.decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// nextLine reads the next line that is not blank.
+func (p *streamParser) nextLine() (json.RawMessage, error) {
+	for {
+		line, err := p.lines.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		start := p.read
+		p.read += int64(len(line))
+		if msg := bytes.TrimSpace(line); len(msg) > 0 {
+			p.end = start + int64(len(bytes.TrimRightFunc(line, unicode.IsSpace)))
+			if !json.Valid(msg) {
+				// the error of Unmarshal describes the syntax error
+				var v json.RawMessage
+				return msg, json.Unmarshal(msg, &v)
+			}
+			return msg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// handleError applies the error policy, it returns the error if the parser needs to stop.
+func (p *streamParser) handleError(perr *ParseError) error {
+	switch p.policy {
+	case SkipAndCount:
+		p.skipped.Add(1)
+		return nil
+	case Quarantine:
+		if p.quarantine != nil {
+			if _, err := p.quarantine.Write(append(perr.Raw, '\n')); err != nil {
+				return fmt.Errorf("error writing message to quarantine: %w", err)
+			}
+		}
+		p.skipped.Add(1)
+		return nil
+	}
+	return perr
+}
+
+// Skipped returns the number of messages dropped by the SkipAndCount or Quarantine policy.
+func (p *streamParser) Skipped() int64 {
+	return p.skipped.Load()
+}
+
+func (p *streamParser) Close() error {
+	return p.reader.Close()
+}
+
+var errInvalidLevel = errors.New("invalid price level")
+
+// levels converts [price, quantity, ...] entries of the field into updates for the given side,
+// additional values are ignored.
+func levels(field, side string, entries [][]string) ([]Update, error) {
+	updates := make([]Update, 0, len(entries))
+	for _, e := range entries {
+		if len(e) < 2 {
+			return nil, fieldError(field, fmt.Errorf("%w: %q", errInvalidLevel, e))
+		}
+		updates = append(updates, Update{
+			Side:     side,
+			Price:    e[0],
+			Quantity: e[1],
+		})
+	}
+	return updates, nil
+}
+
+// optional returns nil for the zero time, so that times the message does not provide are omitted.
+func optional(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// snapshot marks the updates as levels of a snapshot.
+func snapshot(updates []Update) []Update {
+	for i := range updates {
+		updates[i].Snapshot = true
+	}
+	return updates
+}
@@ -0,0 +1,383 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// collect runs the parser until the end of the stream and returns all updates.
+func collect(t *testing.T, p FeedParser) []Update {
+	t.Helper()
+
+	updates, err := run(p)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return updates
+}
+
+// run runs the parser until it stops and returns all updates and the error that stopped it.
+func run(p FeedParser) ([]Update, error) {
+	updateCh, errCh := p.Run(context.Background())
+	var updates []Update
+	for u := range updateCh {
+		updates = append(updates, u)
+	}
+	err := <-errCh
+	p.Close()
+	return updates, err
+}
+
+func open(t *testing.T, name string) io.ReadCloser {
+	t.Helper()
+	f, err := os.Open("../../testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFeedParsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		fixture  string
+		expected []Update
+	}{
+		{
+			name:    "coinbase level2",
+			format:  "coinbase",
+			fixture: "coinbase-level2.ndjson",
+			expected: []Update{
+				{Symbol: "BTC-USD", Side: BUY, Price: "20301.40", Quantity: "0.02465102", Snapshot: true},
+				{Symbol: "BTC-USD", Side: BUY, Price: "20299.18", Quantity: "0.00130254", Snapshot: true},
+				{Symbol: "BTC-USD", Side: SELL, Price: "20301.61", Quantity: "0.02466294", Snapshot: true},
+				{Symbol: "BTC-USD", Side: SELL, Price: "20302.33", Quantity: "0.50000000", Snapshot: true, Last: true},
+				{Symbol: "BTC-USD", Side: SELL, Price: "20310.61", Quantity: "0.03700000", Time: ts("2022-10-13T14:52:11.354218Z"), Last: true},
+				{Symbol: "BTC-USD", Side: BUY, Price: "20301.40", Quantity: "0.00000000", Time: ts("2022-10-13T14:52:11.412650Z")},
+				{Symbol: "BTC-USD", Side: BUY, Price: "20300.95", Quantity: "0.12000000", Time: ts("2022-10-13T14:52:11.412650Z"), Last: true},
+			},
+		},
+		{
+			name:    "binance depth",
+			format:  "binance",
+			fixture: "binance-depth.ndjson",
+			expected: []Update{
+				{Side: BUY, Price: "19450.00000000", Quantity: "1.20000000", Snapshot: true, Sequence: 21870127531},
+				{Side: BUY, Price: "19449.99000000", Quantity: "0.05000000", Snapshot: true, Sequence: 21870127531},
+				{Side: SELL, Price: "19450.01000000", Quantity: "0.30000000", Snapshot: true, Sequence: 21870127531},
+				{Side: SELL, Price: "19450.50000000", Quantity: "2.00000000", Snapshot: true, Sequence: 21870127531, Last: true},
+				{Symbol: "BTCUSDT", Side: BUY, Price: "19450.00000000", Quantity: "1.10000000", FirstSequence: 21870127530, Sequence: 21870127533, Time: ts("2022-10-13T14:52:11.354Z")},
+				{Symbol: "BTCUSDT", Side: SELL, Price: "19450.01000000", Quantity: "0.00000000", FirstSequence: 21870127530, Sequence: 21870127533, Time: ts("2022-10-13T14:52:11.354Z")},
+				{Symbol: "BTCUSDT", Side: SELL, Price: "19450.20000000", Quantity: "0.40000000", FirstSequence: 21870127530, Sequence: 21870127533, Time: ts("2022-10-13T14:52:11.354Z"), Last: true},
+				{Symbol: "BTCUSDT", Side: BUY, Price: "19449.50000000", Quantity: "3.00000000", FirstSequence: 21870127534, Sequence: 21870127535, Time: ts("2022-10-13T14:52:11.454Z"), Last: true},
+			},
+		},
+		{
+			name:    "kraken book",
+			format:  "kraken",
+			fixture: "kraken-book.ndjson",
+			expected: []Update{
+				{Symbol: "XBT/USD", Side: BUY, Price: "19455.20000", Quantity: "1.52900000", Snapshot: true, Time: ts("2022-10-13T14:52:11.765567Z")},
+				{Symbol: "XBT/USD", Side: BUY, Price: "19454.10000", Quantity: "0.30000000", Snapshot: true, Time: ts("2022-10-13T14:52:11.765567Z")},
+				{Symbol: "XBT/USD", Side: SELL, Price: "19455.30000", Quantity: "2.50700000", Snapshot: true, Time: ts("2022-10-13T14:52:11.765567Z")},
+				{Symbol: "XBT/USD", Side: SELL, Price: "19455.80000", Quantity: "0.40000000", Snapshot: true, Time: ts("2022-10-13T14:52:11.765567Z"), Last: true},
+				{Symbol: "XBT/USD", Side: SELL, Price: "19455.30000", Quantity: "0.00000000", Time: ts("2022-10-13T14:52:11.456738Z")},
+				{Symbol: "XBT/USD", Side: SELL, Price: "19456.00000", Quantity: "1.00000000", Time: ts("2022-10-13T14:52:11.456738Z"), Last: true},
+				{Symbol: "XBT/USD", Side: SELL, Price: "19455.80000", Quantity: "0.50000000", Time: ts("2022-10-13T14:52:11.55674Z")},
+				{Symbol: "XBT/USD", Side: BUY, Price: "19455.20000", Quantity: "1.20000000", Time: ts("2022-10-13T14:52:11.55674Z"), Last: true},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewFeedParser(tc.format, open(t, tc.fixture))
+			assert.NoError(t, err)
+			updates := collect(t, p)
+			var offset int64
+			for i := range updates {
+				assert.GreaterOrEqual(t, updates[i].Offset, offset)
+				offset = updates[i].Offset
+				updates[i].Offset = 0
+			}
+			assert.Equal(t, tc.expected, updates)
+		})
+	}
+}
+
+func TestNewFeedParser(t *testing.T) {
+	for _, format := range Formats {
+		p, err := NewFeedParser(format, io.NopCloser(strings.NewReader("")))
+		assert.NoError(t, err)
+		assert.NotNil(t, p)
+	}
+	_, err := NewFeedParser("bitstamp", io.NopCloser(strings.NewReader("")))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func ts(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func TestJSONStreamParser(t *testing.T) {
+	updates := collect(t, NewJSONStreamParser(open(t, "order-book-data.json")))
+	// 1372 bids and 4402 asks of the snapshot and 1581 l2updates
+	assert.Len(t, updates, 7355)
+	assert.Equal(t, Update{Side: BUY, Price: "20301.40", Quantity: "0.02465102", Snapshot: true, Offset: 149109}, updates[0])
+	assert.Equal(t, Update{Side: SELL, Price: "20310.61", Quantity: "0.03700000", Offset: 149176, Last: true}, updates[1372+4402])
+
+	// concatenated arrays, e.g. of several files
+	arrays := `[{"type":"l2update","changes":[["buy","1","1"]]}]` + "\n" + `[]` + "\n" + `[{"type":"l2update","changes":[["sell","2","1"]]}]` + "\n"
+	updates = collect(t, NewJSONStreamParser(io.NopCloser(strings.NewReader(arrays))))
+	assert.Equal(t, []Update{
+		{Side: BUY, Price: "1", Quantity: "1", Offset: 48, Last: true},
+		{Side: SELL, Price: "2", Quantity: "1", Offset: 102, Last: true},
+	}, updates)
+	// resumed after the last message of the first array
+	updates = collect(t, NewJSONStreamParser(io.NopCloser(strings.NewReader(arrays)), WithOffset(48)))
+	assert.Equal(t, []Update{{Side: SELL, Price: "2", Quantity: "1", Offset: 102, Last: true}}, updates)
+}
+
+func TestErrorPolicy(t *testing.T) {
+	stream := `[{"type":"snapshot","bids":[["20301.40","0.02465102"]],"asks":[]},
+{"type":"l2update","changes":[["sell",20310.61,"0.03700000"]]},
+{"type":"l2update","changes":[["hold","20310.61","0.03700000"]]},
+{"type":"l2update","changes":[["sell","20310.61","0.03700000"]]}]`
+	reader := func() io.ReadCloser {
+		return io.NopCloser(strings.NewReader(stream))
+	}
+
+	updates, err := run(NewJSONStreamParser(reader()))
+	assert.Len(t, updates, 1)
+	var perr *ParseError
+	assert.ErrorAs(t, err, &perr)
+	// the field path of type errors depends on the go version
+	assert.True(t, strings.HasPrefix(perr.Field, "changes"))
+	assert.Equal(t, int64(65), perr.Offset)
+	assert.Equal(t, `{"type":"l2update","changes":[["sell",20310.61,"0.03700000"]]}`, string(perr.Raw))
+
+	p := NewJSONStreamParser(reader(), WithErrorPolicy(SkipAndCount))
+	updates, err = run(p)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, int64(2), p.Skipped())
+
+	var quarantine bytes.Buffer
+	p = NewJSONStreamParser(reader(), WithQuarantine(&quarantine))
+	updates, err = run(p)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, int64(2), p.Skipped())
+	assert.Equal(t, `{"type":"l2update","changes":[["sell",20310.61,"0.03700000"]]}`+"\n"+
+		`{"type":"l2update","changes":[["hold","20310.61","0.03700000"]]}`+"\n", quarantine.String())
+
+	// broken framing stops the parser regardless of the policy
+	p = NewJSONStreamParser(io.NopCloser(strings.NewReader(`[{"type":"l2update"},{"type":`)), WithErrorPolicy(SkipAndCount))
+	_, err = run(p)
+	assert.ErrorAs(t, err, &perr)
+	assert.Nil(t, perr.Raw)
+}
+
+func TestErrorPolicyLines(t *testing.T) {
+	stream := `{"type":"snapshot","bids":[["20301.40","0.02465102"]],"asks":[]}
+{"type":"l2update","changes":[["sell","20310.61"
+{"type":"l2update","changes":[["sell","20310.61","0.03700000"]]}
+`
+	reader := func() io.ReadCloser {
+		return io.NopCloser(strings.NewReader(stream))
+	}
+
+	updates, err := run(NewJSONStreamParser(reader()))
+	assert.Len(t, updates, 1)
+	var perr *ParseError
+	assert.ErrorAs(t, err, &perr)
+	assert.Equal(t, int64(64), perr.Offset)
+	assert.Equal(t, `{"type":"l2update","changes":[["sell","20310.61"`, string(perr.Raw))
+
+	// a truncated line is a malformed message, the next line is parsed
+	p := NewJSONStreamParser(reader(), WithErrorPolicy(SkipAndCount))
+	updates, err = run(p)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, int64(1), p.Skipped())
+	assert.Equal(t, int64(len(stream)-1), updates[1].Offset)
+
+	var quarantine bytes.Buffer
+	p = NewJSONStreamParser(reader(), WithQuarantine(&quarantine))
+	updates, err = run(p)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Len(t, updates, 2)
+	assert.Equal(t, `{"type":"l2update","changes":[["sell","20310.61"`+"\n", quarantine.String())
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		newParser func(rc io.ReadCloser, opts ...Option) FeedParser
+		open      func() io.ReadCloser
+	}{
+		{
+			name:      "array from file",
+			newParser: func(rc io.ReadCloser, opts ...Option) FeedParser { return NewJSONStreamParser(rc, opts...) },
+			open:      func() io.ReadCloser { return open(t, "order-book-data.json") },
+		},
+		{
+			name:      "gzip compressed array",
+			newParser: func(rc io.ReadCloser, opts ...Option) FeedParser { return NewJSONStreamParser(rc, opts...) },
+			open:      func() io.ReadCloser { return compress(t, "gzip", read(t, "order-book-data.json")) },
+		},
+		{
+			name:      "ndjson from stream",
+			newParser: func(rc io.ReadCloser, opts ...Option) FeedParser { return NewCoinbaseParser(rc, opts...) },
+			open: func() io.ReadCloser {
+				// hide the io.Seeker of the file
+				return struct{ io.ReadCloser }{open(t, "coinbase-level2.ndjson")}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			all := collect(t, tc.newParser(tc.open()))
+			for _, i := range []int{0, len(all) / 2, len(all) - 1} {
+				offset := all[i].Offset
+				// the updates of the next message
+				next := i
+				for next < len(all) && all[next].Offset == offset {
+					next++
+				}
+				resumed := collect(t, tc.newParser(tc.open(), WithOffset(offset)))
+				assert.Equal(t, append([]Update(nil), all[next:]...), resumed)
+			}
+		})
+	}
+}
+
+func read(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := io.ReadAll(open(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// compress returns the data compressed in the format, gzip, zstd or none.
+func compress(t *testing.T, format string, data []byte) io.ReadCloser {
+	t.Helper()
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch format {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "zstd":
+		var err error
+		if w, err = zstd.NewWriter(&b); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		return io.NopCloser(bytes.NewReader(data))
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return io.NopCloser(&b)
+}
+
+// framing returns the messages of a newline delimited fixture as array or the messages of an array fixture
+// newline delimited.
+func framing(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+		return append(append([]byte("[\n"), bytes.Join(lines, []byte(",\n"))...), []byte("\n]")...)
+	}
+	var b bytes.Buffer
+	for _, m := range messages {
+		b.Write(m)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func TestFramingAndCompression(t *testing.T) {
+	for _, fixture := range []string{"order-book-data.json", "coinbase-level2.ndjson", "binance-depth.ndjson", "kraken-book.ndjson"} {
+		format := "json"
+		if ext := filepath.Ext(fixture); ext == ".ndjson" {
+			format = strings.Split(fixture, "-")[0]
+		}
+		newParser := func(rc io.ReadCloser) FeedParser {
+			p, err := NewFeedParser(format, rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return p
+		}
+		data := read(t, fixture)
+		expected := collect(t, newParser(compress(t, "none", data)))
+		for i := range expected {
+			expected[i].Offset = 0
+		}
+
+		for _, compression := range []string{"none", "gzip", "zstd"} {
+			for _, reframe := range []bool{false, true} {
+				name := fmt.Sprintf("%s %s reframed=%v", fixture, compression, reframe)
+				t.Run(name, func(t *testing.T) {
+					input := data
+					if reframe {
+						input = framing(t, data)
+					}
+					updates := collect(t, newParser(compress(t, compression, input)))
+					for i := range updates {
+						updates[i].Offset = 0
+					}
+					assert.Equal(t, expected, updates)
+				})
+			}
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	data := read(t, "coinbase-level2.ndjson")
+	for _, compression := range []string{"none", "gzip", "zstd"} {
+		rc, err := Decompress(compress(t, compression, data))
+		assert.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.Equal(t, data, b)
+		assert.NoError(t, rc.Close())
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	received := ts("2022-10-13T14:52:11.5Z")
+	msg := []byte(`{"type": "l2update", "product_id": "BTC-USD", "changes": [["buy", "1.0", "1.0"]]}`)
+	b := AppendEnvelope(nil, *received, msg)
+	assert.Equal(t, `{"recv":"2022-10-13T14:52:11.5Z","msg":`+string(msg)+"}\n", string(b))
+
+	updates := collect(t, NewCoinbaseParser(io.NopCloser(bytes.NewReader(b))))
+	assert.Equal(t, []Update{{Symbol: "BTC-USD", Side: BUY, Price: "1.0", Quantity: "1.0", Received: received, Offset: int64(len(b) - 1), Last: true}}, updates)
+}
@@ -0,0 +1,124 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KrakenParser parses messages of the Kraken book channel. Book messages are arrays of the channel ID, one or two
+// objects holding the changed levels, the channel name and the pair, messages of other channels are ignored. Snapshots use the keys "as" and "bs",
+// updates "a" and "b". Kraken does not provide sequence numbers, the time of a message is the latest timestamp of
+// its levels.
+//
+//	[0,{"as":[["5541.30000","2.50700000","1534614248.123678"]],"bs":[["5541.20000","1.52900000","1534614248.765567"]]},"book-10","XBT/USD"]
+//	[1234,{"a":[["5541.30000","2.50700000","1534614248.456738"]],"c":"974942666"},"book-10","XBT/USD"]
+type KrakenParser struct {
+	*streamParser
+}
+
+func NewKrakenParser(rc io.ReadCloser, opts ...Option) *KrakenParser {
+	return &KrakenParser{
+		streamParser: newStreamParser(rc, parseKrakenMessage, opts...),
+	}
+}
+
+func parseKrakenMessage(raw json.RawMessage) ([]Update, error) {
+	// events like heartbeats or subscription status are objects
+	if len(raw) == 0 || raw[0] != '[' {
+		return nil, nil
+	}
+
+	var msg []json.RawMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	if len(msg) < 4 {
+		return nil, fmt.Errorf("expected at least 4 elements in channel message but got %d", len(msg))
+	}
+
+	// e.g. trade, ticker or spread messages on the same connection
+	var channel string
+	if err := json.Unmarshal(msg[len(msg)-2], &channel); err != nil {
+		return nil, fieldError("channelName", err)
+	}
+	if !strings.HasPrefix(channel, "book") {
+		return nil, nil
+	}
+
+	var pair string
+	if err := json.Unmarshal(msg[len(msg)-1], &pair); err != nil {
+		return nil, fieldError("pair", err)
+	}
+
+	var updates []Update
+	var ts time.Time
+	// the objects are between the channel ID and the channel name and pair
+	for _, obj := range msg[1 : len(msg)-2] {
+		var book map[string]json.RawMessage
+		if err := json.Unmarshal(obj, &book); err != nil {
+			return nil, err
+		}
+		for _, key := range []string{"bs", "b", "as", "a"} {
+			entries, ok := book[key]
+			if !ok {
+				continue
+			}
+			var l [][]string
+			if err := json.Unmarshal(entries, &l); err != nil {
+				return nil, fieldError(key, err)
+			}
+			side := BUY
+			if key == "as" || key == "a" {
+				side = SELL
+			}
+			u, err := levels(key, side, l)
+			if err != nil {
+				return nil, err
+			}
+			if key == "as" || key == "bs" {
+				u = snapshot(u)
+			}
+			for _, e := range l {
+				if len(e) < 3 {
+					continue
+				}
+				t, err := krakenTime(e[2])
+				if err != nil {
+					return nil, fieldError(key, err)
+				}
+				if t.After(ts) {
+					ts = t
+				}
+			}
+			updates = append(updates, u...)
+		}
+	}
+	for i := range updates {
+		updates[i].Symbol = pair
+		updates[i].Time = optional(ts)
+	}
+	return updates, nil
+}
+
+// krakenTime parses timestamps in seconds with microsecond fraction, e.g. 1534614248.456738.
+func krakenTime(s string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(s, ".")
+	secs, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsecs int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		if nsecs, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(secs, nsecs).UTC(), nil
+}
@@ -0,0 +1,30 @@
+package parse
+
+import "io"
+
+// Option configures a parser.
+type Option func(*streamParser)
+
+// WithErrorPolicy sets how messages that cannot be parsed are handled, the default is FailFast.
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(p *streamParser) {
+		p.policy = policy
+	}
+}
+
+// WithQuarantine sets the Quarantine policy, raw messages that cannot be parsed are written to w,
+// one message per line.
+func WithQuarantine(w io.Writer) Option {
+	return func(p *streamParser) {
+		p.policy = Quarantine
+		p.quarantine = w
+	}
+}
+
+// WithOffset resumes the stream at the offset of an update, e.g. of a checkpoint. The offsets of the updates are
+// relative to the start of the stream. Streams that are not an io.Seeker are read up to the offset.
+func WithOffset(offset int64) Option {
+	return func(p *streamParser) {
+		p.start = offset
+	}
+}
@@ -1,7 +1,28 @@
 package parse
 
+import "time"
+
 type Update struct {
-	Side     string
-	Price    string
-	Quantity string
+	// Symbol is the product or pair of the update as named by the exchange, e.g. BTC-USD.
+	// It is empty if the message does not name it, e.g. Binance REST snapshots.
+	Symbol   string `json:"symbol,omitempty"`
+	Side     string `json:"side"`
+	Price    string `json:"price"`
+	Quantity string `json:"quantity"`
+	// Snapshot is true for the levels of a snapshot message, they replace the whole side of the book.
+	Snapshot bool `json:"snapshot,omitempty"`
+	// Sequence is the sequence number or update ID of the message the update belongs to,
+	// zero if the feed does not provide one.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// FirstSequence is the first update ID covered by the message for feeds that combine several updates into one
+	// message, e.g. Binance's U. It is zero if the message covers a single sequence number.
+	FirstSequence uint64 `json:"firstSequence,omitempty"`
+	// Time is the exchange timestamp of the message, nil if the feed does not provide one.
+	Time *time.Time `json:"time,omitempty"`
+	// Received is the time the message was received at, it is set for recorded messages only.
+	Received *time.Time `json:"received,omitempty"`
+	// Offset is the position in the stream after the message the update belongs to.
+	Offset int64 `json:"offset"`
+	// Last is true for the last update of a message, the message is complete once it has been received.
+	Last bool `json:"last,omitempty"`
 }
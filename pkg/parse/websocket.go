@@ -0,0 +1,246 @@
+package parse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultPingInterval = 25 * time.Second
+	defaultReadTimeout  = 60 * time.Second
+	defaultMinBackoff   = 500 * time.Millisecond
+	defaultMaxBackoff   = 30 * time.Second
+)
+
+// WebSocketConfig configures a WebSocketSource, zero values are replaced by defaults.
+type WebSocketConfig struct {
+	URL        string
+	Channel    string
+	ProductIDs []string
+	// Subscription returns the message sent after every (re)connect, the default is a Coinbase subscribe message.
+	// No message is sent if it returns nil.
+	Subscription func(channel string, productIDs []string) ([]byte, error)
+	// PingInterval is the interval in which pings are sent to the server.
+	PingInterval time.Duration
+	// ReadTimeout is the time without any message or pong after which the connection is considered dead.
+	ReadTimeout time.Duration
+	// MinBackoff and MaxBackoff bound the exponential backoff between reconnects.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxRetries is the number of consecutive failed connection attempts after which the source gives up,
+	// zero retries forever.
+	MaxRetries int
+	// OnMessage is called with the receive time of every message before it is parsed, e.g. to record the feed.
+	// The message must not be modified.
+	OnMessage func(received time.Time, msg []byte)
+}
+
+// CoinbaseSubscription returns a subscribe message for the Coinbase websocket feed.
+func CoinbaseSubscription(channel string, productIDs []string) ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string   `json:"type"`
+		ProductIDs []string `json:"product_ids"`
+		Channels   []string `json:"channels"`
+	}{
+		Type:       "subscribe",
+		ProductIDs: productIDs,
+		Channels:   []string{channel},
+	})
+}
+
+// WebSocketSource is a stream of newline delimited messages received from a websocket, it can be read by any of
+// the stream parsers. It subscribes to the configured channel after connecting, keeps the connection alive with
+// pings and reconnects with exponential backoff if the connection drops. Messages are not buffered, a slow reader
+// applies backpressure to the connection.
+type WebSocketSource struct {
+	cfg      WebSocketConfig
+	dialer   *websocket.Dialer
+	pr       *io.PipeReader
+	pw       *io.PipeWriter
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	connects atomic.Int64
+}
+
+// NewWebSocketSource connects to the websocket in the background.
+func NewWebSocketSource(cfg WebSocketConfig) *WebSocketSource {
+	if cfg.Subscription == nil {
+		cfg.Subscription = CoinbaseSubscription
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = defaultPingInterval
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = defaultReadTimeout
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	s := &WebSocketSource{
+		cfg:    cfg,
+		dialer: websocket.DefaultDialer,
+		pr:     pr,
+		pw:     pw,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Connects returns the number of successful connections, it is greater than one after a reconnect.
+func (s *WebSocketSource) Connects() int64 {
+	return s.connects.Load()
+}
+
+func (s *WebSocketSource) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+// Reconnect drops the connection, the source reconnects and subscribes again, e.g. to receive a fresh snapshot after
+// updates have been lost. It does nothing if the source is not connected or a reconnect is pending.
+func (s *WebSocketSource) Reconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Close closes the connection and stops reconnecting, pending reads return io.ErrClosedPipe.
+func (s *WebSocketSource) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.pr.Close()
+	<-s.done
+	return err
+}
+
+func (s *WebSocketSource) run() {
+	defer close(s.done)
+
+	backoff := s.cfg.MinBackoff
+	failures := 0
+	for {
+		received, err := s.session()
+		if s.ctx.Err() != nil {
+			s.pw.Close()
+			return
+		}
+		if errors.Is(err, io.ErrClosedPipe) {
+			return
+		}
+		if received {
+			// the connection was healthy before it dropped
+			failures = 0
+			backoff = s.cfg.MinBackoff
+		}
+		failures++
+		if s.cfg.MaxRetries > 0 && failures > s.cfg.MaxRetries {
+			s.pw.CloseWithError(err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			s.pw.Close()
+			return
+		}
+		backoff *= 2
+		if backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
+
+// session connects and subscribes and copies messages to the pipe until the connection fails.
+// It returns true if at least one message was received.
+func (s *WebSocketSource) session() (bool, error) {
+	conn, _, err := s.dialer.DialContext(s.ctx, s.cfg.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+	s.connects.Add(1)
+
+	msg, err := s.cfg.Subscription(s.cfg.Channel, s.cfg.ProductIDs)
+	if err != nil {
+		return false, err
+	}
+	if msg != nil {
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return false, err
+		}
+	}
+
+	extendDeadline := func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
+	}
+	conn.SetPongHandler(extendDeadline)
+	if err := extendDeadline(""); err != nil {
+		return false, err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.ping(conn, stop)
+
+	received := false
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		if s.cfg.OnMessage != nil {
+			s.cfg.OnMessage(time.Now(), msg)
+		}
+		if err := extendDeadline(""); err != nil {
+			return received, err
+		}
+		if _, err := s.pw.Write(append(msg, '\n')); err != nil {
+			return received, err
+		}
+	}
+}
+
+func (s *WebSocketSource) ping(conn *websocket.Conn, stop chan struct{}) {
+	ticker := time.NewTicker(s.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.cfg.PingInterval)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package parse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// replayServer sends the messages of the testdata file to every client after it subscribed.
+// The first connection is dropped after dropAfter messages to test reconnects.
+func replayServer(t *testing.T, dropAfter int) (*httptest.Server, *atomic.Int64, int) {
+	t.Helper()
+
+	b, err := os.ReadFile("../../testdata/order-book-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(b, &messages); err != nil {
+		t.Fatal(err)
+	}
+
+	var subscriptions atomic.Int64
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.JSONEq(t, `{"type":"subscribe","product_ids":["BTC-USD"],"channels":["level2"]}`, string(msg))
+		n := subscriptions.Add(1)
+
+		// answer pings while sending, the reader stops once the client closed the connection
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		start := 0
+		if n > 1 {
+			start = dropAfter
+		}
+		for i := start; i < len(messages); i++ {
+			if n == 1 && i == dropAfter {
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, messages[i]); err != nil {
+				return
+			}
+		}
+		// keep the connection open until the client closes it
+		<-closed
+	}))
+	return srv, &subscriptions, len(messages)
+}
+
+func TestWebSocketSource(t *testing.T) {
+	srv, subscriptions, sent := replayServer(t, 100)
+	defer srv.Close()
+
+	var received atomic.Int64
+
+	source := NewWebSocketSource(WebSocketConfig{
+		URL:          "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Channel:      "level2",
+		ProductIDs:   []string{"BTC-USD"},
+		PingInterval: 10 * time.Millisecond,
+		MinBackoff:   time.Millisecond,
+		OnMessage: func(t time.Time, msg []byte) {
+			received.Add(1)
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewCoinbaseParser(source)
+	updateCh, errCh := p.Run(ctx)
+
+	// all messages have been received once the updates of the last one are parsed
+	var updates []Update
+	for len(updates) < 7355 {
+		select {
+		case u := <-updateCh:
+			updates = append(updates, u)
+		case err := <-errCh:
+			t.Fatalf("unexpected error after %d updates: %v", len(updates), err)
+		}
+	}
+	assert.Equal(t, Update{Side: BUY, Price: "20301.40", Quantity: "0.02465102", Snapshot: true, Offset: updates[0].Offset}, updates[0])
+	assert.Equal(t, int64(2), subscriptions.Load())
+	assert.Equal(t, int64(2), source.Connects())
+	assert.Equal(t, int64(sent), received.Load())
+
+	assert.NoError(t, source.Close())
+	// the parser stops once the source is closed
+	assert.Error(t, <-errCh)
+}
+
+func TestWebSocketSourceReconnect(t *testing.T) {
+	srv, subscriptions, _ := replayServer(t, 1<<30)
+	defer srv.Close()
+
+	source := NewWebSocketSource(WebSocketConfig{
+		URL:        "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Channel:    "level2",
+		ProductIDs: []string{"BTC-USD"},
+		MinBackoff: time.Millisecond,
+	})
+	go io.Copy(io.Discard, source)
+
+	assert.Eventually(t, func() bool { return source.Connects() == 1 }, time.Second, time.Millisecond)
+	source.Reconnect()
+	assert.Eventually(t, func() bool { return subscriptions.Load() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), source.Connects())
+
+	assert.NoError(t, source.Close())
+}
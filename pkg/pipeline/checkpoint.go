@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/fbngrm/crypto-compare/pkg/feed"
+)
+
+var ErrNoCheckpointer = errors.New("applier does not support checkpoints")
+
+// Checkpointer is implemented by appliers whose state can be checkpointed, e.g. a feed.BookManager.
+// Checkpoint is only called between messages.
+type Checkpointer interface {
+	Checkpoint() map[string]feed.BookState
+}
+
+// Checkpoint holds the state of the books after all updates up to the offset of the stream have been applied.
+// A stream can be resumed with parse.WithOffset after restoring the books.
+type Checkpoint struct {
+	Offset int64                     `json:"offset"`
+	Books  map[string]feed.BookState `json:"books"`
+}
+
+// SaveCheckpoint writes the checkpoint to a temporary file that replaces the file at path, so that a crash
+// never leaves a partially written checkpoint.
+func SaveCheckpoint(path string, cp Checkpoint) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(cp); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(b, &cp)
+	return cp, err
+}
@@ -0,0 +1,23 @@
+package pipeline
+
+import "github.com/fbngrm/crypto-compare/pkg/parse"
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithErrorHandler sets a function that is called for updates rejected by the applier, errors of its flush and
+// errors saving checkpoints.
+func WithErrorHandler(fn func(u parse.Update, err error)) Option {
+	return func(r *Runner) {
+		r.onError = fn
+	}
+}
+
+// WithCheckpoint saves a checkpoint to the path every n messages and when the pipeline stops.
+// The applier needs to implement Checkpointer.
+func WithCheckpoint(path string, n int) Option {
+	return func(r *Runner) {
+		r.checkpointPath = path
+		r.checkpointEvery = n
+	}
+}
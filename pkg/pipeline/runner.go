@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+)
+
+// Applier applies the updates of a feed, e.g. a feed.Synchronizer or a feed.BookManager.
+type Applier interface {
+	Apply(u parse.Update) error
+}
+
+// Result describes how a pipeline stopped.
+type Result struct {
+	// Last is the last update that has been applied without error.
+	Last parse.Update
+	// Applied is the number of updates applied without error.
+	Applied int64
+	// Rejected is the number of updates the applier returned an error for.
+	Rejected int64
+	// Checkpoint is the offset of the last checkpoint written, zero if none was written.
+	Checkpoint int64
+	// Interrupted is true if the pipeline was stopped by its context before the end of the stream.
+	Interrupted bool
+	// Err is the error that stopped the parser, it is nil at the end of the stream or when interrupted.
+	Err error
+}
+
+// Runner owns a parser and the goroutine applying its updates. It stops reading when its context is cancelled
+// or the stream ends and returns once all updates parsed so far have been applied.
+type Runner struct {
+	parser  parse.FeedParser
+	applier Applier
+	onError func(u parse.Update, err error)
+	// checkpoints are written to the path every n messages and when the pipeline stops
+	checkpointPath  string
+	checkpointEvery int
+}
+
+func NewRunner(p parse.FeedParser, a Applier, opts ...Option) *Runner {
+	r := &Runner{
+		parser:  p,
+		applier: a,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run blocks until the pipeline is drained. On cancellation the parser finishes the message it is handling and
+// the stream is closed to unblock a pending read. Appliers with a Flush() error or Close() method are flushed or
+// closed after the last update, e.g. to wait for asynchronously applied updates.
+func (r *Runner) Run(ctx context.Context) Result {
+	var res Result
+	if _, ok := r.applier.(Checkpointer); r.checkpointPath != "" && !ok {
+		res.Err = ErrNoCheckpointer
+		return res
+	}
+
+	updateCh, errCh := r.parser.Run(ctx)
+
+	// offset of the last message handed to the applier
+	var offset int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		messages := 0
+		for u := range updateCh {
+			// the parser sends all updates of a message before the next one, the previous message is complete
+			if u.Offset != offset && offset > 0 {
+				messages++
+				if r.checkpointPath != "" && messages >= r.checkpointEvery {
+					r.checkpoint(&res, offset)
+					messages = 0
+				}
+			}
+			offset = u.Offset
+
+			if err := r.applier.Apply(u); err != nil {
+				res.Rejected++
+				r.reportError(u, err)
+				continue
+			}
+			res.Last = u
+			res.Applied++
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		res.Interrupted = true
+	case <-done:
+	}
+	// stops a read that is blocked on the stream, e.g. an idle websocket
+	closeErr := r.parser.Close()
+	<-done
+	err := <-errCh
+
+	if r.checkpointPath != "" && offset > 0 {
+		r.checkpoint(&res, offset)
+	}
+
+	switch a := r.applier.(type) {
+	case interface{ Flush() error }:
+		if err := a.Flush(); err != nil {
+			r.reportError(res.Last, err)
+		}
+	case interface{ Close() }:
+		a.Close()
+	}
+
+	switch {
+	case res.Interrupted || errors.Is(err, io.EOF):
+		// errors caused by closing the stream are expected
+		res.Err = nil
+	case err != nil:
+		res.Err = err
+	default:
+		res.Err = closeErr
+	}
+	return res
+}
+
+// checkpoint saves the state of the applier after all updates up to the offset have been applied.
+func (r *Runner) checkpoint(res *Result, offset int64) {
+	cp := Checkpoint{
+		Offset: offset,
+		Books:  r.applier.(Checkpointer).Checkpoint(),
+	}
+	if err := SaveCheckpoint(r.checkpointPath, cp); err != nil {
+		r.reportError(res.Last, fmt.Errorf("error saving checkpoint: %w", err))
+		return
+	}
+	res.Checkpoint = offset
+}
+
+func (r *Runner) reportError(u parse.Update, err error) {
+	if r.onError != nil {
+		r.onError(u, err)
+	}
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/feed"
+	"github.com/fbngrm/crypto-compare/pkg/orderbook"
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+type applierFunc func(u parse.Update) error
+
+func (f applierFunc) Apply(u parse.Update) error {
+	return f(u)
+}
+
+func TestRunnerEndOfStream(t *testing.T) {
+	f, err := os.Open("../../testdata/order-book-data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob := orderbook.NewOrderBook()
+	res := NewRunner(parse.NewJSONStreamParser(f), feed.NewSynchronizer(ob)).Run(context.Background())
+
+	assert.NoError(t, res.Err)
+	assert.False(t, res.Interrupted)
+	assert.Equal(t, int64(7355), res.Applied)
+	assert.Equal(t, int64(0), res.Rejected)
+	assert.Equal(t, parse.Update{Side: parse.BUY, Price: "20262.93", Quantity: "0.00000000", Offset: 252508, Last: true}, res.Last)
+	assert.Equal(t, "20292.95", ob.GetSpread().HighestBidPrice().StringFixed(2))
+}
+
+func TestRunnerInterrupt(t *testing.T) {
+	pr, pw := io.Pipe()
+	applied := make(chan parse.Update)
+	r := NewRunner(parse.NewCoinbaseParser(pr), applierFunc(func(u parse.Update) error {
+		applied <- u
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resCh := make(chan Result)
+	go func() {
+		resCh <- r.Run(ctx)
+	}()
+
+	go pw.Write([]byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[["1.0","1.0"],["0.9","1.0"]],"asks":[]}` + "\n"))
+	<-applied
+
+	// the second update of the message is in flight when the pipeline is interrupted, the parser is blocked
+	// reading the next message
+	cancel()
+	select {
+	case <-resCh:
+		t.Fatal("the runner returned before the pipeline was drained")
+	case <-time.After(10 * time.Millisecond):
+	}
+	<-applied
+
+	res := <-resCh
+	assert.True(t, res.Interrupted)
+	assert.NoError(t, res.Err)
+	assert.Equal(t, int64(2), res.Applied)
+	assert.Equal(t, "0.9", res.Last.Price)
+
+	// the stream has been closed
+	_, err := pw.Write([]byte("{}\n"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+// interruptingManager cancels the pipeline after n updates.
+type interruptingManager struct {
+	*feed.BookManager
+	n      int
+	cancel context.CancelFunc
+}
+
+func (m *interruptingManager) Apply(u parse.Update) error {
+	if m.n--; m.n == 0 {
+		m.cancel()
+	}
+	return m.BookManager.Apply(u)
+}
+
+func state(t *testing.T, m *feed.BookManager) string {
+	t.Helper()
+	b, err := json.Marshal(m.Checkpoint())
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestRunnerCheckpoint(t *testing.T) {
+	newManager := func() *feed.BookManager {
+		return feed.NewBookManager(func(string) *orderbook.OrderBook { return orderbook.NewOrderBook() }, feed.WithDefaultSymbol("BTC-USD"))
+	}
+	newParser := func(opts ...parse.Option) parse.FeedParser {
+		f, err := os.Open("../../testdata/order-book-data.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parse.NewJSONStreamParser(f, opts...)
+	}
+	expected := newManager()
+	res := NewRunner(newParser(), expected).Run(context.Background())
+	assert.NoError(t, res.Err)
+
+	// interrupted after the snapshot and a part of the updates, the parser is ahead of the applier by at most the
+	// buffer of its update channel
+	path := t.TempDir() + "/checkpoint.json"
+	ctx, cancel := context.WithCancel(context.Background())
+	m := newManager()
+	res = NewRunner(newParser(), &interruptingManager{BookManager: m, n: 3000, cancel: cancel}, WithCheckpoint(path, 1000)).Run(ctx)
+	assert.True(t, res.Interrupted)
+	assert.NoError(t, res.Err)
+	assert.Equal(t, res.Last.Offset, res.Checkpoint)
+	assert.NotEqual(t, state(t, expected), state(t, m))
+
+	cp, err := LoadCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Checkpoint, cp.Offset)
+
+	resumed := newManager()
+	assert.NoError(t, resumed.Restore(cp.Books))
+	res = NewRunner(newParser(parse.WithOffset(cp.Offset)), resumed).Run(context.Background())
+	assert.NoError(t, res.Err)
+	assert.Greater(t, res.Applied, int64(0))
+	assert.Less(t, res.Applied, int64(7355-3000))
+	assert.Equal(t, state(t, expected), state(t, resumed))
+
+	// checkpoints need an applier that supports them
+	res = NewRunner(newParser(), feed.NewSynchronizer(orderbook.NewOrderBook()), WithCheckpoint(path, 1)).Run(context.Background())
+	assert.ErrorIs(t, res.Err, ErrNoCheckpointer)
+}
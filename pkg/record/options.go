@@ -0,0 +1,28 @@
+package record
+
+import "time"
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithCompression sets the compression of the files, the default is gzip.
+func WithCompression(c Compression) Option {
+	return func(r *Recorder) {
+		r.compression = c
+	}
+}
+
+// WithMaxSize starts a new file once the uncompressed messages of the current one would exceed n bytes. A single
+// message larger than n is written to a file of its own.
+func WithMaxSize(n int64) Option {
+	return func(r *Recorder) {
+		r.maxSize = n
+	}
+}
+
+// WithMaxAge starts a new file for the first message received d after the first message of the current file.
+func WithMaxAge(d time.Duration) Option {
+	return func(r *Recorder) {
+		r.maxAge = d
+	}
+}
@@ -0,0 +1,205 @@
+package record
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	ErrClosed             = errors.New("recorder closed")
+	ErrUnknownCompression = errors.New("unknown compression")
+)
+
+// Compression is the compression of the recorded files.
+type Compression int
+
+const (
+	Gzip Compression = iota
+	Zstd
+	None
+)
+
+// ParseCompression returns the compression by its name, gzip, zstd or none.
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	case "none":
+		return None, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownCompression, s)
+}
+
+func (c Compression) ext() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Recorder writes the raw messages of a feed with their receive time to rotating, compressed files. The files
+// hold one envelope per line, see parse.AppendEnvelope, and can be replayed by the parser of the feed, one by one
+// or concatenated in the order of their names.
+type Recorder struct {
+	dir         string
+	prefix      string
+	compression Compression
+	maxSize     int64
+	maxAge      time.Duration
+
+	mu     sync.Mutex
+	f      *os.File
+	zw     io.WriteCloser // compressor, nil without compression
+	w      *bufio.Writer
+	size   int64     // uncompressed bytes written to the current file
+	opened time.Time // receive time of the first message of the current file
+	files  []string
+	buf    []byte
+	closed bool
+}
+
+// NewRecorder records to files in dir named by the prefix and the receive time of their first message, e.g.
+// coinbase-20221013T145211.354218000Z.ndjson.gz. The directory is created if it does not exist.
+func NewRecorder(dir, prefix string, opts ...Option) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		dir:    dir,
+		prefix: prefix,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// Record writes the message, a new file is started if the current one exceeds the size or age limit.
+func (r *Recorder) Record(received time.Time, msg []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+
+	r.buf = parse.AppendEnvelope(r.buf[:0], received, msg)
+	if r.f != nil && r.full(received, len(r.buf)) {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+	if r.f == nil {
+		if err := r.open(received); err != nil {
+			return err
+		}
+	}
+	n, err := r.w.Write(r.buf)
+	r.size += int64(n)
+	return err
+}
+
+// full returns true if the current file must be rotated before the next line is written.
+func (r *Recorder) full(received time.Time, n int) bool {
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && received.Sub(r.opened) >= r.maxAge
+}
+
+func (r *Recorder) open(received time.Time) error {
+	name := fmt.Sprintf("%s-%s.ndjson%s", r.prefix, received.UTC().Format("20060102T150405.000000000Z"), r.compression.ext())
+	path := filepath.Join(r.dir, name)
+	// never overwrite a recording
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = f
+	switch r.compression {
+	case Gzip:
+		r.zw = gzip.NewWriter(f)
+		w = r.zw
+	case Zstd:
+		zw, err := zstd.NewWriter(f, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		r.zw = zw
+		w = zw
+	}
+	r.f = f
+	r.w = bufio.NewWriter(w)
+	r.size = 0
+	r.opened = received
+	r.files = append(r.files, path)
+	return nil
+}
+
+// closeFile completes the current file, it is readable on its own afterwards.
+func (r *Recorder) closeFile() error {
+	err := r.w.Flush()
+	if r.zw != nil {
+		if zerr := r.zw.Close(); err == nil {
+			err = zerr
+		}
+	}
+	if ferr := r.f.Close(); err == nil {
+		err = ferr
+	}
+	r.f, r.zw, r.w = nil, nil, nil
+	return err
+}
+
+// Flush writes the buffered messages to the current file, a compressed file can be read up to them afterwards.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := r.zw.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Files returns the paths of the files written so far in the order they were written.
+func (r *Recorder) Files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Close completes the current file, further messages are rejected with ErrClosed.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.f == nil {
+		return nil
+	}
+	return r.closeFile()
+}
@@ -0,0 +1,143 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2022, 10, 13, 14, 52, 11, 0, time.UTC)
+
+func run(t *testing.T, p parse.FeedParser) ([]parse.Update, error) {
+	t.Helper()
+	updateCh, errCh := p.Run(context.Background())
+	var updates []parse.Update
+	for u := range updateCh {
+		updates = append(updates, u)
+	}
+	err := <-errCh
+	p.Close()
+	return updates, err
+}
+
+// replay parses the recorded files concatenated.
+func replay(t *testing.T, files []string) ([]parse.Update, error) {
+	t.Helper()
+	var readers []io.Reader
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		d, err := parse.Decompress(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers = append(readers, d)
+	}
+	return run(t, parse.NewCoinbaseParser(io.NopCloser(io.MultiReader(readers...))))
+}
+
+func TestRecorder(t *testing.T) {
+	b, err := os.ReadFile("../../testdata/coinbase-level2.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	expected, err := run(t, parse.NewCoinbaseParser(io.NopCloser(bytes.NewReader(b))))
+	assert.ErrorIs(t, err, io.EOF)
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		files int
+	}{
+		{
+			name:  "gzip",
+			files: 1,
+		},
+		{
+			name:  "zstd rotated by size",
+			opts:  []Option{WithCompression(Zstd), WithMaxSize(400)},
+			files: 3,
+		},
+		{
+			name:  "uncompressed rotated by age",
+			opts:  []Option{WithCompression(None), WithMaxAge(2 * time.Second)},
+			files: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRecorder(t.TempDir()+"/captures", "coinbase", tc.opts...)
+			assert.NoError(t, err)
+			for i, msg := range messages {
+				assert.NoError(t, r.Record(start.Add(time.Duration(i)*time.Second), msg))
+			}
+			assert.NoError(t, r.Close())
+			assert.ErrorIs(t, r.Record(start, messages[0]), ErrClosed)
+			files := r.Files()
+			assert.Len(t, files, tc.files)
+
+			// the messages are recorded byte for byte
+			var recorded [][]byte
+			for _, name := range files {
+				f, err := os.Open(name)
+				assert.NoError(t, err)
+				d, err := parse.Decompress(f)
+				assert.NoError(t, err)
+				s := bufio.NewScanner(d)
+				for s.Scan() {
+					var e struct {
+						Msg json.RawMessage `json:"msg"`
+					}
+					assert.NoError(t, json.Unmarshal(s.Bytes(), &e))
+					recorded = append(recorded, e.Msg)
+				}
+				f.Close()
+			}
+			assert.Equal(t, messages, recorded)
+
+			// and replayed like the feed
+			updates, err := replay(t, files)
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Len(t, updates, len(expected))
+			for i := range updates {
+				assert.NotNil(t, updates[i].Received)
+				updates[i].Received = nil
+				updates[i].Offset = expected[i].Offset
+			}
+			assert.Equal(t, expected, updates)
+		})
+	}
+}
+
+func TestRecorderInvalidMessage(t *testing.T) {
+	r, err := NewRecorder(t.TempDir(), "coinbase", WithCompression(None))
+	assert.NoError(t, err)
+	assert.NoError(t, r.Record(start, []byte(`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","1.0","1.0"]]}`)))
+	assert.NoError(t, r.Record(start.Add(time.Second), []byte(`{"type":"l2update",`)))
+	assert.NoError(t, r.Close())
+
+	updates, err := replay(t, r.Files())
+	assert.Len(t, updates, 1)
+	assert.Equal(t, start, *updates[0].Received)
+	// the invalid message does not break the framing of the recording
+	var perr *parse.ParseError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, `{"type":"l2update",`, string(perr.Raw))
+
+	_, err = ParseCompression("lz4")
+	assert.ErrorIs(t, err, ErrUnknownCompression)
+}
@@ -0,0 +1,34 @@
+package replay
+
+import "time"
+
+// Option configures a Replayer.
+type Option func(*Replayer)
+
+// WithSpeed sets the replay speed, 1 replays in real time, 2 twice as fast, 0 as fast as possible.
+func WithSpeed(speed float64) Option {
+	return func(r *Replayer) {
+		r.speed = speed
+	}
+}
+
+// WithClock sets the clock the replayer waits with, the default is the system clock.
+func WithClock(c Clock) Option {
+	return func(r *Replayer) {
+		r.clock = c
+	}
+}
+
+// WithStart seeks to the capture time before the replay starts, see SeekTo.
+func WithStart(t time.Time) Option {
+	return func(r *Replayer) {
+		r.seek = t
+	}
+}
+
+// WithPaused starts the replay paused.
+func WithPaused() Option {
+	return func(r *Replayer) {
+		r.paused = true
+	}
+}
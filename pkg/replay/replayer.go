@@ -0,0 +1,234 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+)
+
+var ErrSeekBackward = errors.New("cannot seek backward in a stream")
+
+var _ parse.FeedParser = (*Replayer)(nil)
+
+// Replayer releases the updates of a parser honoring the timestamps of their messages, e.g. to replay a capture in
+// real time. It is a parse.FeedParser itself and sits between the parser and the pipeline. The delay between two
+// messages is the difference of their timestamps divided by the speed, the receive time of recorded messages or
+// the exchange timestamp. Messages without a timestamp are released immediately. All updates of a message are
+// released at once.
+//
+// The replay is controlled by the capture clock, the position in capture time. It advances with the wall clock
+// times the speed and stops while the replay is paused. Releasing a message early, e.g. by Step or SeekTo, moves
+// it to the time of the message.
+type Replayer struct {
+	parser parse.FeedParser
+	clock  Clock
+
+	mu         sync.Mutex
+	speed      float64
+	paused     bool
+	steps      int       // messages to release while paused
+	seek       time.Time // messages before are released immediately
+	anchor     time.Time // capture time at anchorWall
+	anchorWall time.Time
+	position   time.Time     // time of the last released message
+	changed    chan struct{} // closed and replaced when the replay is controlled
+
+	UpdateCh chan parse.Update
+	ErrCh    chan error
+}
+
+// NewReplayer replays the updates of the parser as fast as possible unless a speed is set.
+func NewReplayer(p parse.FeedParser, opts ...Option) *Replayer {
+	r := &Replayer{
+		parser:   p,
+		clock:    realClock{},
+		changed:  make(chan struct{}),
+		UpdateCh: make(chan parse.Update, 1000),
+		ErrCh:    make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run starts the parser and the replay. Cancelling the context stops the replay at the next message boundary.
+func (r *Replayer) Run(ctx context.Context) (chan parse.Update, chan error) {
+	updateCh, errCh := r.parser.Run(ctx)
+	go func() {
+		err := r.run(ctx, updateCh)
+		close(r.UpdateCh)
+		// let the parser stop, the updates of messages that have not been released are dropped
+		for range updateCh {
+		}
+		if parseErr := <-errCh; err == nil {
+			err = parseErr
+		}
+		r.ErrCh <- err
+		close(r.ErrCh)
+	}()
+	return r.UpdateCh, r.ErrCh
+}
+
+func (r *Replayer) run(ctx context.Context, updateCh chan parse.Update) error {
+	var offset int64 = -1
+	for u := range updateCh {
+		if u.Offset != offset {
+			// the first update of a message
+			if err := r.wait(ctx, timestamp(u)); err != nil {
+				return err
+			}
+			offset = u.Offset
+		}
+		r.UpdateCh <- u
+	}
+	return nil
+}
+
+// timestamp returns the receive time of recorded messages, the exchange timestamp otherwise. It is zero if the
+// update has neither.
+func timestamp(u parse.Update) time.Time {
+	switch {
+	case u.Received != nil:
+		return *u.Received
+	case u.Time != nil:
+		return *u.Time
+	}
+	return time.Time{}
+}
+
+// wait blocks until the message with the timestamp is due.
+func (r *Replayer) wait(ctx context.Context, t time.Time) error {
+	for {
+		r.mu.Lock()
+		var after <-chan time.Time
+		switch {
+		case r.paused && r.steps > 0:
+			r.steps--
+			r.release(t)
+			r.mu.Unlock()
+			return nil
+		case r.paused:
+			// wait until the replay is controlled
+		case t.IsZero() || r.speed <= 0 || t.Before(r.seek):
+			r.release(t)
+			r.mu.Unlock()
+			return nil
+		default:
+			now := r.clock.Now()
+			if r.anchor.IsZero() {
+				r.anchor, r.anchorWall = t, now
+			}
+			if r.anchor.Before(r.seek) {
+				// timing continues at the time sought
+				r.anchor, r.anchorWall = r.seek, now
+			}
+			d := time.Duration(float64(t.Sub(r.anchor))/r.speed) - now.Sub(r.anchorWall)
+			if d <= 0 {
+				r.release(t)
+				r.mu.Unlock()
+				return nil
+			}
+			after = r.clock.After(d)
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-after:
+		}
+	}
+}
+
+// release moves the position to the time of a released message, the capture clock follows if the message is
+// released ahead of it.
+func (r *Replayer) release(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	r.position = t
+	if t.After(r.captureTime()) {
+		r.anchor, r.anchorWall = t, r.clock.Now()
+	}
+}
+
+// captureTime returns the capture clock.
+func (r *Replayer) captureTime() time.Time {
+	if r.anchor.IsZero() || r.paused || r.speed <= 0 {
+		return r.anchor
+	}
+	elapsed := r.clock.Now().Sub(r.anchorWall)
+	return r.anchor.Add(time.Duration(float64(elapsed) * r.speed))
+}
+
+// control applies a change to the replay and wakes it up, the capture clock is anchored at the current time
+// before.
+func (r *Replayer) control(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.anchor.IsZero() {
+		r.anchor, r.anchorWall = r.captureTime(), r.clock.Now()
+	}
+	fn()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// SetSpeed changes the replay speed, 0 replays as fast as possible.
+func (r *Replayer) SetSpeed(speed float64) {
+	r.control(func() { r.speed = speed })
+}
+
+// Pause stops releasing messages until Resume is called.
+func (r *Replayer) Pause() {
+	r.control(func() { r.paused = true })
+}
+
+// Resume continues a paused replay at the position it was paused at.
+func (r *Replayer) Resume() {
+	r.control(func() {
+		r.paused = false
+		r.steps = 0
+	})
+}
+
+// Step releases the next message of a paused replay.
+func (r *Replayer) Step() {
+	r.control(func() {
+		if r.paused {
+			r.steps++
+		}
+	})
+}
+
+// SeekTo releases the messages before the capture time immediately and continues the replay at the time.
+// The stream can only be sought forward, the books are built from all messages.
+func (r *Replayer) SeekTo(t time.Time) error {
+	var err error
+	r.control(func() {
+		if t.Before(r.captureTime()) {
+			err = ErrSeekBackward
+			return
+		}
+		r.seek = t
+	})
+	return err
+}
+
+// Position returns the timestamp of the last released message, zero if none had a timestamp.
+func (r *Replayer) Position() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.position
+}
+
+// Close closes the parser.
+func (r *Replayer) Close() error {
+	return r.parser.Close()
+}
@@ -0,0 +1,211 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/crypto-compare/pkg/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2022, 10, 13, 14, 52, 11, 0, time.UTC)
+
+// fakeClock advances instantly when it is waited for.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waited []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.waited = append(c.waited, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Waited() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waited
+}
+
+// blockingClock never fires.
+type blockingClock struct {
+	fakeClock
+	waiting chan struct{}
+}
+
+func (c *blockingClock) After(d time.Duration) <-chan time.Time {
+	c.waiting <- struct{}{}
+	return nil
+}
+
+// capture returns a Coinbase feed with a message of two updates for every delay, the delays are relative to the
+// start of the capture. Negative delays are messages without a timestamp.
+func capture(delays ...time.Duration) io.ReadCloser {
+	var b strings.Builder
+	for i, d := range delays {
+		var ts string
+		if d >= 0 {
+			ts = fmt.Sprintf(`,"time":%q`, start.Add(d).Format(time.RFC3339Nano))
+		}
+		fmt.Fprintf(&b, `{"type":"l2update","product_id":"BTC-USD","changes":[["buy","%d","1"],["sell","%d","1"]]%s}`+"\n", 100+i, 200+i, ts)
+	}
+	return io.NopCloser(strings.NewReader(b.String()))
+}
+
+func collect(t *testing.T, r *Replayer) []parse.Update {
+	t.Helper()
+	updateCh, errCh := r.Run(context.Background())
+	var updates []parse.Update
+	for u := range updateCh {
+		updates = append(updates, u)
+	}
+	assert.ErrorIs(t, <-errCh, io.EOF)
+	return updates
+}
+
+func TestReplayerSpeed(t *testing.T) {
+	delays := []time.Duration{0, time.Second, 3 * time.Second, -1, 3500 * time.Millisecond}
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected []time.Duration
+	}{
+		{
+			name: "as fast as possible",
+		},
+		{
+			name:     "real time",
+			opts:     []Option{WithSpeed(1)},
+			expected: []time.Duration{time.Second, 2 * time.Second, 500 * time.Millisecond},
+		},
+		{
+			name:     "twice as fast",
+			opts:     []Option{WithSpeed(2)},
+			expected: []time.Duration{500 * time.Millisecond, time.Second, 250 * time.Millisecond},
+		},
+		{
+			name:     "start",
+			opts:     []Option{WithSpeed(1), WithStart(start.Add(2 * time.Second))},
+			expected: []time.Duration{time.Second, 500 * time.Millisecond},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			r := NewReplayer(parse.NewCoinbaseParser(capture(delays...)), append(tc.opts, WithClock(clock))...)
+			updates := collect(t, r)
+			assert.Len(t, updates, 2*len(delays))
+			for i := 0; i < len(updates); i += 2 {
+				assert.Equal(t, fmt.Sprint(100+i/2), updates[i].Price)
+				assert.Equal(t, fmt.Sprint(200+i/2), updates[i+1].Price)
+			}
+			assert.Equal(t, tc.expected, clock.Waited())
+			assert.Equal(t, start.Add(3500*time.Millisecond), r.Position())
+		})
+	}
+}
+
+// next receives the next update or fails if none is released in time.
+func next(t *testing.T, updateCh chan parse.Update) parse.Update {
+	t.Helper()
+	select {
+	case u := <-updateCh:
+		return u
+	case <-time.After(time.Second):
+		t.Fatal("no update released")
+	}
+	return parse.Update{}
+}
+
+func nothing(t *testing.T, updateCh chan parse.Update) {
+	t.Helper()
+	select {
+	case u := <-updateCh:
+		t.Fatalf("unexpected update %v", u)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestReplayerControl(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	r := NewReplayer(parse.NewCoinbaseParser(capture(0, time.Second, 2*time.Second, 4*time.Second, 8*time.Second)),
+		WithSpeed(1), WithClock(clock), WithPaused())
+	updateCh, errCh := r.Run(context.Background())
+
+	// paused, a step releases all updates of a message
+	nothing(t, updateCh)
+	r.Step()
+	assert.Equal(t, "100", next(t, updateCh).Price)
+	assert.Equal(t, "200", next(t, updateCh).Price)
+	nothing(t, updateCh)
+	r.Step()
+	assert.Equal(t, "101", next(t, updateCh).Price)
+	next(t, updateCh)
+	assert.Equal(t, start.Add(time.Second), r.Position())
+	assert.Empty(t, clock.Waited())
+
+	// the capture clock has been stopped at the second message
+	assert.ErrorIs(t, r.SeekTo(start), ErrSeekBackward)
+	assert.NoError(t, r.SeekTo(start.Add(3*time.Second)))
+	r.SetSpeed(2)
+	r.Resume()
+	for i := 2; i < 5; i++ {
+		assert.Equal(t, fmt.Sprint(100+i), next(t, updateCh).Price)
+		next(t, updateCh)
+	}
+	_, ok := <-updateCh
+	assert.False(t, ok)
+	assert.ErrorIs(t, <-errCh, io.EOF)
+	// the third message is released by seeking, the fourth one second after the time sought, the last one
+	// four seconds later, at twice the speed
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 2 * time.Second}, clock.Waited())
+}
+
+func TestReplayerInterrupt(t *testing.T) {
+	clock := &blockingClock{waiting: make(chan struct{})}
+	r := NewReplayer(parse.NewCoinbaseParser(capture(0, time.Hour)), WithSpeed(1), WithClock(clock))
+	ctx, cancel := context.WithCancel(context.Background())
+	updateCh, errCh := r.Run(ctx)
+
+	next(t, updateCh)
+	next(t, updateCh)
+	// waiting for the second message
+	<-clock.waiting
+	cancel()
+	_, ok := <-updateCh
+	assert.False(t, ok)
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+	assert.Equal(t, start, r.Position())
+}
+
+func TestReplayerRecording(t *testing.T) {
+	// recorded messages are timed by their receive time
+	var b []byte
+	for i, d := range []time.Duration{0, 3 * time.Second} {
+		msg := fmt.Sprintf(`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","%d","1"]],"time":%q}`, 100+i, start.Format(time.RFC3339Nano))
+		b = parse.AppendEnvelope(b, start.Add(d), []byte(msg))
+	}
+	clock := &fakeClock{now: time.Now()}
+	r := NewReplayer(parse.NewCoinbaseParser(io.NopCloser(bytes.NewReader(b))), WithSpeed(1), WithClock(clock))
+	assert.Len(t, collect(t, r), 2)
+	assert.Equal(t, []time.Duration{3 * time.Second}, clock.Waited())
+}